@@ -79,47 +79,32 @@ func (fi bindataFileInfo) Sys() interface{} {
 }
 
 var _bindataDisplayhtml = []byte(
-	"\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x56\x6d\x73\xdb\x36\x0c\xfe\xde\x5f\x81\xea\x2e\x97\x36\x17\x89\x76" +
-	"\xd2\x6c\x9d\x27\xf9\xae\x4b\x73\x6b\xb6\x36\xed\x9a\xec\xed\x7a\xfd\x40\x8b\x90\x45\x97\x22\x55\x82\x52\xe2\xb9" +
-	"\xfe\xef\x3b\x4a\x7e\x51\x1c\xdb\x6b\xef\xf6\x45\x36\x48\xe0\x01\xf1\x10\x20\x10\x3f\x7e\xf9\xf6\xfc\xe6\xef\x77" +
-	"\x17\x90\xbb\x42\x0d\x1f\xc5\xfe\x07\x14\xd7\xe3\x24\x40\x1d\x0c\x1f\x01\xc4\x39\x72\xe1\xff\x00\xc4\x05\x3a\x0e" +
-	"\x69\xce\x2d\xa1\x4b\x82\xca\x65\xe1\xf3\xa0\xbb\x95\x3b\x57\x86\xf8\xb9\x92\x75\x12\xfc\x15\xfe\xfe\x22\x3c\x37" +
-	"\x45\xc9\x9d\x1c\x29\x0c\x20\x35\xda\xa1\x76\x49\x70\x79\x91\xa0\x18\xe3\x3d\x4b\xcd\x0b\x4c\x82\x5a\xe2\x6d\x69" +
-	"\xac\xeb\x28\xdf\x4a\xe1\xf2\x44\x60\x2d\x53\x0c\x1b\xe1\x18\xa4\x96\x4e\x72\x15\x52\xca\x15\x26\xfd\x25\xd0\xe3" +
-	"\x30\x84\x9b\x1c\x81\x8f\x4c\x8d\x70\x0a\x0d\xb0\xe3\x63\x82\xa3\xa2\x22\x77\x04\xa9\x29\x10\x32\x69\xc9\x81\xd4" +
-	"\xe0\x72\x04\x1f\xdb\x8f\xc0\xf5\x14\x8c\xcb\xd1\x36\xf2\xd2\x37\x78\xa3\xd6\xe6\x88\x67\x0e\xed\x91\x37\x21\x6c" +
-	"\x21\xc3\x70\xe1\xd5\x49\xa7\x70\x78\x8e\xd6\xc9\x4c\xa6\xdc\x21\xd4\x5c\x49\xc1\x9d\x34\x1a\x2c\x52\xa5\x1c\xc5" +
-	"\xac\xd5\x7a\xb4\x3e\xe8\x4f\xc6\x38\x72\x96\x97\x6b\x24\x25\xf5\x27\xb0\xa8\x92\x80\xdc\x54\x21\xe5\x88\x2e\x80" +
-	"\xdc\x62\x96\x04\x8c\x15\xfc\x2e\x15\x3a\x1a\x2d\xed\xbc\x90\x9a\x82\xad\x16\xd8\x69\x74\x1a\x9d\xb1\x94\x68\xbd" +
-	"\x16\x15\x52\x47\x29\x51\xd0\x75\xfd\xea\xe6\xcd\xeb\x33\xa0\x5c\x16\xc0\xb5\x80\xf7\x48\xa5\xd1\x22\x9a\x10\x64" +
-	"\xc6\xc2\xe5\xc5\x73\xa0\xaa\xf4\xd7\x00\x26\x5b\x28\xa3\xc2\x02\xb5\xa3\xc6\xa0\x40\x21\x39\x7c\xae\xd0\x4a\xec" +
-	"\x10\xe1\xa1\xff\x7c\xf1\xfe\xea\xf2\xea\xe7\x41\x17\x54\x18\x24\x7d\xe8\xe0\xd6\xd8\x4f\x20\x33\x98\x9a\x0a\xfc" +
-	"\x45\x37\x17\x50\xf2\x31\x42\x2d\x39\x64\x52\xe1\x80\xb1\x7b\x70\x1f\x64\x06\xca\xc1\xe5\x05\xfc\xf0\xb1\x5d\x05" +
-	"\x88\x29\xb5\xb2\x74\x40\x36\x4d\x02\x9f\x6f\x34\x60\xcc\x10\x45\x0b\x7e\x3c\x25\x3e\x89\xcf\x28\x97\x35\x3b\x8d" +
-	"\xbe\x8f\x4e\xd6\x72\x43\xc7\x84\x82\x61\xcc\x5a\x98\x6f\x41\xb5\x6d\x48\xac\x1f\x3d\x8b\x4e\x96\xd2\x0e\xc4\xf8" +
-	"\xf1\x07\xd4\x42\x66\x1f\xdb\x70\x62\xb6\x2c\xa2\x78\x64\xc4\x74\xa1\x23\x64\x0d\xa9\xe2\x44\x49\xe0\x53\x8e\x4b" +
-	"\x8d\x36\x58\x9d\xa8\xb3\x6b\xcd\x6d\x00\x4d\x4e\x24\x41\x8e\x72\x9c\xbb\xc1\x49\xaf\xbc\xf3\x4e\x85\xac\x17\x57" +
-	"\xfb\xd0\x64\xb5\xb1\xe9\x4b\x85\x85\x08\xfb\x27\x2b\x5f\x9b\x1a\x25\xd7\xa8\xa0\xf9\x86\x02\x33\x5e\x29\x77\x4f" +
-	"\x77\x8b\x76\xe8\x03\x94\x7a\xbc\xa1\x07\xb0\xbf\x30\xee\x83\xb6\xd1\xec\xf7\xe3\xf9\x7b\xe0\x24\x76\x7c\xa4\x70" +
-	"\xa9\xd8\x0a\xcd\x37\x24\x67\x65\x89\xe2\x81\x85\xb7\xb1\x0f\x17\xfd\x72\x3e\x7c\x65\xc8\xc5\xcc\xe5\x43\x2f\x5c" +
-	"\x12\x55\x68\x57\xe2\x1f\x3e\x06\xa8\xb4\x93\x6a\xb5\xf6\xbe\x09\xa6\x11\x1f\xba\x61\xdb\xfc\xcc\x0e\x9a\x5a\xcb" +
-	"\x0d\xb9\x63\xcf\x85\x7f\x8f\x16\x94\x00\x19\xeb\x50\xc0\xc1\x7c\xcb\xe9\x66\x07\xbe\x82\x2c\x52\x74\xed\xb8\xab" +
-	"\x08\x92\x04\xd2\x35\xc3\x6f\x7f\xdd\x6e\xb6\x33\xda\xd9\x01\xa0\xda\x87\x78\x71\x57\x4a\x8b\x74\x6d\x8c\xde\x03" +
-	"\xbd\x64\xfe\x96\x5b\xbd\x2d\x09\x56\xae\x08\xbf\x02\x45\x70\x3d\xee\x54\xc2\x26\x88\xaf\xab\xdd\x28\x62\x9b\x19" +
-	"\xdc\xa3\xae\x9b\x92\x3b\x70\x00\x62\x3e\x1a\x59\x68\x9e\xed\x24\x98\xcd\x36\x0d\xa3\x97\x57\xd7\x57\xbc\x40\x82" +
-	"\x2f\x30\x31\x52\x0f\x0e\x8f\xe1\x10\xe6\xf3\x60\x38\x9b\x35\xd7\x0a\xf3\x79\xcc\x3c\xc6\x9e\xf3\xec\xe3\x03\x60" +
-	"\x0d\xb4\x07\x61\x2f\x19\x6c\x17\x1b\x9e\xa6\x5d\x7c\x6c\x89\xb5\x2d\x81\xe8\xdc\x14\x85\xd1\x3e\x6a\x98\xcf\x3b" +
-	"\xce\xff\x37\x3f\x57\xc6\xbd\xf0\x8d\x16\xbe\x80\x93\x05\x0e\x82\x93\x5e\xef\xbb\xb0\xd7\x0f\x7b\x27\xd0\x3f\x1b" +
-	"\xf4\x9e\x0d\x7a\x67\xf0\xe6\xfa\x26\xf8\x26\xff\xb3\x4e\x76\x47\xd7\xce\x4a\x3d\x7e\xf2\xb4\xb9\x9e\xed\x66\x3b" +
-	"\x2b\x16\xb5\xf0\x45\xfb\x80\xed\x98\x35\x6f\xcd\xf0\xdb\x1f\xb3\xcc\x18\xb7\x25\xd3\x63\xbe\xe8\xfa\xcb\x4e\x34" +
-	"\x96\x2e\xaf\x46\x4d\x17\x7a\x5d\xfd\x23\x33\xb4\xac\xb4\xa6\xf0\x75\x9a\xe6\x98\x7e\x0a\x86\xef\xac\x29\xce\x97" +
-	"\xa2\x4f\x9d\x1a\x2d\xf9\x87\xb6\x49\xc3\xff\x38\xda\xc6\xc2\x46\x57\x59\x6f\x76\x37\x9a\x76\x3f\xf9\xad\x42\x3b" +
-	"\x85\x27\x1a\x53\x24\xe2\x76\xda\xbc\x6a\xab\xd1\xe6\x90\xe0\x17\x5e\xf3\xeb\xb6\xb7\x96\xaa\x1a\x4b\x4d\x4f\xd7" +
-	"\x2d\xbe\xdb\x74\x19\xe3\x13\x7e\x17\x8d\x8d\x19\x2b\xe4\xa5\xa4\x26\x5a\xbf\xc6\x94\x1c\x11\x9b\xf8\x79\x63\xca" +
-	"\xfa\x51\xbf\x1f\x9d\x2e\xa4\x9d\xcd\x37\x0c\xe1\x52\xa7\xaa\x12\x08\x5c\x29\x3f\xc3\x95\x52\xa1\x58\x1e\x01\x9e" +
-	"\x8c\x50\x99\xdb\xa7\xc7\x60\x2c\xc8\x85\xa2\xd4\x42\xd6\x52\x54\x5c\x35\xb3\x08\x01\x27\xd0\x88\x02\xc5\xae\x03" +
-	"\x7f\xed\x44\x36\xd9\x1c\xc8\x36\x8f\x1c\xb3\x76\x2a\x88\x59\x3b\x85\xff\x1b\x00\x00\xff\xff\xe7\x19\x78\x14\x96" +
-	"\x0b\x00\x00")
+	"\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xb5\x58\x59\x73\xdb\x36\x10\x7e\xcf\xaf\xd8\x70\x26\xe3\x63\x44\xd2\xb2\xe3\x36\x55\x25\xcd\xa4\x8a\xa7\x71\xeb\xd8\xa9\xa5\xa4\x47\x26\x0f\x10\x09\x8a\x90\x41\x82\x21\x40\xd9\x6a\x92\xff\xde\x05\x78\x88\x3a\x48\xdb" +
+	"\x9d\xe4\x45\x22\x16\xbb\xdf\xde\xb8\xfa\x4f\x5f\x5d\x8d\x26\x7f\xbf\x3d\x83\x50\x45\x7c\xf8\xa4\xaf\xff\x80\x93\x78\x36\xb0\x68\x6c\x0d\x9f\x00\xf4\x43\x4a\x7c\xfd\x81\x9f\x11\x55\x04\xbc\x90\xa4\x92\xaa\x81\x95\xa9\xc0\x7e\x61\xd5\xa7\x42\xa5\x12\x9b\x7e" +
+	"\xca\xd8\x62\x60\xfd\x65\xbf\x7b\x69\x8f\x44\x94\x10\xc5\xa6\x9c\x5a\xe0\x89\x58\xd1\x18\xe5\xce\xcf\x06\xd4\x9f\xd1\x35\xc9\x98\x44\x74\x60\x2d\x18\xbd\x4d\x44\xaa\x6a\xcc\xb7\xcc\x57\xe1\xc0\xa7\x0b\xe6\x51\xdb\x0c\x3a\xc0\x62\xa6\x18\xe1\xb6\xf4\x08\xa7" +
+	"\x83\x6e\x09\xf4\xd4\xb6\x61\x12\x52\x20\x53\xb1\xa0\x70\x02\x06\x58\x91\x99\x84\xc3\x28\x93\xea\x10\x41\x23\x0a\x01\x4b\xa5\x42\x08\x50\xc8\xaa\x7d\xfb\x19\x48\xbc\x04\x81\xc3\xd4\x8c\x4b\xdd\xa0\x85\x72\x99\x43\x12\x28\x9a\x1e\x6a\x11\x49\x73\x48\xdb\x2e" +
+	"\xb4\x2a\xa6\x38\x1d\x8e\x68\xaa\x58\xc0\x3c\xa2\x28\x2c\x08\x67\x3e\x7a\x2d\x62\x48\xa9\xcc\xb8\x92\x7d\x37\xe7\x7a\xb2\x32\xf4\x17\x21\x94\x54\x29\x49\x56\x48\x9c\xc5\x37\x28\xc1\x07\x96\x54\x4b\x4e\x65\x48\x29\x46\x22\x4c\x69\x30\xb0\x5c\x37\x22\x77\x9e" +
+	"\x1f\x3b\xd3\x52\x4e\x0f\xd0\x38\xb7\x22\xb8\x27\xce\x89\x73\xea\x7a\x52\xae\x68\x4e\xc4\x90\x4b\x4a\xab\xae\xfa\xf5\xe4\xcd\xc5\x29\xc8\x90\x45\xe8\xb9\x0f\xd7\x54\x26\x22\xf6\x9d\xb9\x84\x40\xa4\x70\x7e\xf6\x02\x64\x96\xe8\x34\x80\x08\x0a\x66\xca\x69\x84" +
+	"\x21\x91\x46\x20\xa2\x3e\x23\xf0\x29\xa3\x29\xa3\xb5\x40\x68\xe8\x3f\x5f\x5e\x5f\x9e\x5f\xfe\xda\xab\x83\xfa\x82\xca\x78\x4f\xc1\xad\x48\x6f\x80\x05\xb0\x14\x19\xe8\x44\x9b\x04\x24\x64\x86\x01\x43\xb8\x80\x71\xda\x73\xdd\x35\xb8\x0f\xc8\xcd\x15\x5a\x04\x3f" +
+	"\x7d\xcc\xa9\x48\x97\x5e\xca\x12\x05\x32\xf5\x06\x96\xae\x37\x89\x52\x42\x4a\xa7\x88\x8f\x0e\x89\x2e\xe2\x53\xf4\x6f\x81\x21\xf9\xd1\x39\x5e\x8d\x4d\x38\xe6\x18\x8d\xbe\x9b\xc3\x3c\x06\x35\xcd\x5d\x72\xbb\xce\x73\xc4\x2c\x46\x0d\x88\xfd\xa7\x1f\x68\xec\xb3" +
+	"\xe0\x63\xee\x4e\xdf\x2d\x9b\xa8\x3f\x15\xfe\xb2\xe0\xf1\xd9\x02\x3c\x4e\xa4\x1c\x58\xba\xe4\x08\x8b\x69\x6a\x55\x16\xd5\x66\x53\x71\x6b\x81\xa9\x09\x34\x8e\xb2\x59\xa8\x7a\xc7\x47\xc9\x9d\x56\x8a\x5c\x45\x6a\xb7\x45\xaa\x89\x4d\x5d\xdc\x8e\x7c\xbb\x7b\x5c" +
+	"\xe9\xda\xe4\x48\x48\x4c\x39\x98\x5f\xdb\xa7\x01\xc1\x12\x5e\xe3\xdd\xc1\x6d\x6b\x07\x59\x3c\xdb\xe0\x03\x68\x6f\x8c\x75\xd0\xdc\x9b\x76\x3d\x3a\x7e\x5b\x4a\xfa\x8a\xe0\x12\x53\x32\xe6\x03\xf3\x6b\x63\x17\xb0\x84\xfa\x5b\x12\x5a\x26\xdd\x26\x6a\x72\x38\x7c" +
+	"\x2d\xa4\xc2\x96\x0d\x87\x7a\x70\x2e\x25\x56\x7a\x35\x7c\xaf\x7d\x80\x2c\x56\x8c\x57\xb4\x6b\xe3\x8c\x19\x6e\xab\x71\x77\xe9\xf9\xfc\xcc\xf4\x5a\x88\x8a\x3a\x3a\x16\x7a\x3d\x2a\x42\x02\x12\x3b\x8f\xfa\xf0\xec\xeb\x0e\xeb\x50\x0e\x7b\x02\x39\x9d\x0b\x22\xd5" +
+	"\x28\xa4\xde\x8d\x73\x2e\xff\xa1\xa9\xd8\x3f\xd8\x2d\x61\x1c\x2d\x23\xc3\xe2\x40\x58\xc3\xdd\xb8\x94\x17\xc8\x63\x45\x54\x26\x61\x30\x00\x6f\x95\xbb\xab\xdf\x5b\xe0\xff\x17\xe2\xd9\x5d\xc2\x70\x72\x2c\xb0\x1a\xee\xb7\xfc\x96\xa4\xf1\xae\xf2\xaa\x54\xe1\xba" +
+	"\x7c\x3f\x8a\x8f\x1b\x5b\xad\xc7\x36\x41\x74\xc7\x36\xa3\xf8\xc3\x9d\x13\xf5\xa4\xd4\x8b\xbd\x01\x07\x91\xc8\x74\x9a\x82\xd9\x10\x06\xd6\xe7\xcf\x9b\x82\xce\xab\xcb\xf1\x25\xee\x86\x12\xbe\xc0\x5c\xb0\xb8\xb7\xd7\x81\x3d\xf8\xfa\xd5\x1a\x22\xaf\x2e\x18\xfc" +
+	"\xee\xbb\x1a\xa3\xc5\x9e\xb6\x78\x20\x43\x05\xd4\x82\xd0\x1a\x0c\xb7\x29\x1a\x3a\x4c\x4d\xf1\xd8\xe1\x6b\xde\x5c\x0e\x1e\x13\x22\x11\x6b\xaf\xd1\xa6\x9a\xf2\x76\x3d\x8f\x4c\xc7\x0e\xf5\x97\x42\xbd\xd4\x3b\x3b\x86\x5a\xb1\x88\xf6\xac\xe3\xa3\xa3\x1f\xec\xa3" +
+	"\xae\x7d\x74\x0c\xdd\xd3\xde\xd1\xf3\xde\xd1\x29\xbc\x19\x4f\xac\x75\xb3\xee\x55\x7c\xc1\x22\x3c\xa1\xc4\xb3\xba\x01\x7a\xe7\x6c\x98\xab\xec\x70\x7e\xa1\xb8\x2c\xd0\xfd\x26\x3b\x0f\x5a\xaa\x0a\xeb\xa1\x2f\x23\xc2\xf9\x70\x14\xe2\x56\x92\x2f\xb6\xf9\x42\x05" +
+	"\x85\xeb\x6d\xaa\x1f\x12\x82\x0e\x70\x8d\x80\x8b\xd3\x74\xb9\x5e\xc6\x26\x8f\x86\xdc\xa2\x6a\x57\xb2\x4d\x55\x37\x09\x8c\xb3\xe9\x9c\x7a\x6a\x5d\xa2\xa8\x7d\xdc\x6f\x8d\xb3\xdf\xa5\x82\xef\x4f\xf0\xae\xd5\x17\x43\x89\x87\x63\x24\x62\x24\x96\x54\xad\xda\xb0" +
+	"\x70\x31\x5f\x06\xf1\x2f\x45\x3f\x51\xe2\x71\x35\x75\x35\x1a\xbf\x7d\x50\xfa\x35\x63\x6f\x63\x95\x59\x43\x71\xce\xd2\x14\x37\x9f\xca\xae\x1a\x2d\x37\x29\xb7\xfa\xfd\x76\x01\x19\xce\x4b\x7a\xa7\xde\x25\xbe\xae\xe9\xc7\xb5\x4d\x95\x6b\x03\x53\x6c\x0a\xdf\x2a" +
+	"\xa1\x6b\x7d\x7f\x7d\xf1\xb0\x46\xb9\xbe\xd8\x0e\x94\xde\x97\xbd\x94\x17\x3b\x72\x81\x85\x86\x23\xad\x2c\x48\x34\xba\x07\x25\xa9\x74\x23\x57\xaf\x49\x65\x78\x61\xbf\xe0\x29\x63\x7b\x50\x73\x22\x67\x8f\xb1\x64\x50\x21\x17\x22\x31\x35\x85\x13\x1d\x58\xe7\xc2" +
+	"\xcf\xc0\xc0\x55\xe1\x43\x93\x72\xad\xa6\x86\xbe\x43\xf8\x26\x0f\x8b\xde\xa4\xb1\xca\x46\x93\xcd\x1a\xab\x28\xf5\x0a\x2b\xa2\x2d\x3d\x55\x45\x7b\xe2\x8c\x47\x13\x99\xcb\x21\xdd\xb9\x10\xb3\x2f\xc5\x11\xb4\x67\xbd\x8b\x6f\x62\x71\x1b\x03\x17\x33\x5d\x5a\x26" +
+	"\xbe\x9a\x69\x2c\xb2\xd4\xd3\x6b\xc3\x81\x49\x8b\x21\xad\xa7\xe5\x21\x71\x8e\x12\xb5\x34\x5d\x0c\xda\x84\x7a\xe4\xd7\x6b\xb8\xee\xa5\xbe\xdf\x72\x46\x62\x0d\xe8\x95\xdf\x2b\x07\xb5\xda\x35\x72\xb5\xaf\x99\x9c\x75\x60\x15\x1d\xd3\x6d\xc6\x77\x74\x2c\x5f\xbb" +
+	"\xcd\x28\x48\x45\x54\x63\xbb\x4a\x68\x4a\x94\x48\x0d\x9b\x28\x07\xdf\x30\xf9\x2f\x7d\x1f\xff\x24\x95\x2d\x35\x90\xf1\xf2\x40\xc5\x99\x54\x76\x16\x9b\xbb\x89\x0f\xc6\x08\xab\xc9\x8a\xea\xd4\x4b\x50\x45\xc7\xfc\x5e\x57\x27\xdf\x9a\xde\xb6\xf3\x6f\x61\x00\x67" +
+	"\xcd\x4a\x4a\x67\x0a\xfc\x87\x9d\xc9\xb6\xce\x65\x1b\x8b\xdf\x0e\xb0\x47\xed\x9c\xa6\x77\x35\xc8\xaa\x61\x7b\xed\x1e\xb4\x9f\xe0\x8a\x53\x5c\x81\x78\x1f\x54\x7b\xee\x6b\x58\xd7\x3b\x77\xa9\xe6\x3c\xb8\x6d\x89\xa8\x77\x50\x53\x25\xb9\xd9\x37\xdf\xc1\x1b\x2f" +
+	"\x5c\x4d\xc6\xa0\x80\xbe\x2a\x0e\x1f\x7f\x17\x0d\x84\x50\x3b\xae\x13\x7d\x52\x3c\xda\x94\x0f\x09\x33\xa6\xc2\x6c\x6a\x1e\x11\x2e\xb2\x7f\x59\x40\x53\x37\xc1\xb6\xd6\x97\x21\x73\x5e\xb0\x86\x6f\x71\x38\x2a\x87\x3a\x1b\x0b\x9a\x4a\x7d\x4f\x36\xe5\x72\x8f\x69" +
+	"\x1b\x84\x8d\x47\x81\xd5\x64\x7d\xc2\xbc\xd6\xcc\xff\xc0\xf3\xd8\x12\xf6\x63\xea\x61\xeb\x11\xfc\xd4\x01\xaa\x5e\xa6\xf6\x24\xfc\x46\x16\x64\x9c\x3f\x8d\x24\x3c\x9b\xb1\x58\x1e\xac\x5e\x68\xea\x6f\x26\xae\x4b\xe6\xe4\xce\x99\x09\x31\xe3\x94\x24\x4c\x1a\x6f" +
+	"\x35\x0d\x6b\x64\x2a\xdd\xb9\x7e\x2e\x5a\xba\x5d\xa7\xdb\x75\x4e\x8a\x51\xe3\xdb\x09\x9a\x76\x1e\x7b\x3c\xf3\xf1\xd4\xcc\xb9\x59\x41\x99\x5e\x5f\x0a\x13\x60\x7f\x4a\xb9\xb8\x3d\xe8\x00\x5a\xcb\x0a\x46\x86\xb5\xb2\x60\x7e\x46\xb8\x79\x4a\x92\x40\x24\xc4\x94" +
+	"\xfa\x28\xd6\x60\xf0\x43\x1f\xd4\xe6\x9b\xef\x69\x9b\x26\xf7\xdd\xfc\x51\xa7\xef\xe6\x8f\xa8\xff\x01\x6d\xc1\x4c\xd3\x55\x15\x00\x00")
 
 func bindataDisplayhtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -138,10 +123,10 @@ func bindataDisplayhtml() (*asset, error) {
 
 	info := bindataFileInfo{
 		name: "display.html",
-		size: 2966,
+		size: 5461,
 		md5checksum: "",
 		mode: os.FileMode(436),
-		modTime: time.Unix(1538399498, 0),
+		modTime: time.Unix(1792302539, 0),
 	}
 
 	a := &asset{bytes: bytes, info: info}
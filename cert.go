@@ -1,25 +1,46 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
-	"net/http"
+	"net"
 	"net/url"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/Luzifer/go_helpers/v2/str"
 	log "github.com/sirupsen/logrus"
 )
 
 type probeResult uint
 
+// Values are exposed in the JSON output so new results must only be
+// appended to the end of the list
 const (
 	certificateOK probeResult = iota
 	certificateNotFound
 	certificateExpiresSoon
 	certificateInvalid
 	generalFailure
+	certificateExpired
+	certificateNotYetValid
+	certificateUnknownAuthority
+	certificateSelfSigned
+	certificateInvalidIntermediate
+	connectionRefused
+	connectionDNSFailure
+	connectionTimeout
+	connectionHandshakeFailure
+	connectionHandshakeTimeout
+	probeTimeout
+	certificateExpiresCritical
+	certificateRevoked
+	certificateIntermediateRevoked
+	certificateCTPolicyFailed
 )
 
 func (p probeResult) String() string {
@@ -27,75 +48,418 @@ func (p probeResult) String() string {
 	case certificateOK:
 		return "Certificate OK"
 	case certificateExpiresSoon:
-		return fmt.Sprintf("Certificate expires within %s", cfg.ExpireWarning)
+		return "Certificate expires soon"
+	case certificateExpiresCritical:
+		return "Certificate expires very soon"
+	case certificateRevoked:
+		return "Certificate revoked"
+	case certificateIntermediateRevoked:
+		return "Intermediate certificate revoked"
+	case certificateCTPolicyFailed:
+		return "Certificate does not comply with the CT policy"
 	case certificateInvalid:
-		return "Certificate invalid / intermediate certificates not present"
+		return "Certificate invalid"
 	case certificateNotFound:
 		return "Did not find a certificate valid for this domain"
+	case certificateExpired:
+		return "Certificate expired"
+	case certificateNotYetValid:
+		return "Certificate is not yet valid"
+	case certificateUnknownAuthority:
+		return "Certificate signed by unknown authority / intermediate certificates not present"
+	case certificateSelfSigned:
+		return "Certificate is self-signed"
+	case certificateInvalidIntermediate:
+		return "Intermediate certificate invalid"
+	case connectionRefused:
+		return "Connection refused"
+	case connectionDNSFailure:
+		return "Host could not be resolved"
+	case connectionTimeout:
+		return "Connection timed out"
+	case connectionHandshakeFailure:
+		return "TLS handshake failed"
+	case connectionHandshakeTimeout:
+		return "TLS handshake timed out"
+	case probeTimeout:
+		return "Probe timed out"
 
 	default:
 		return "Something went wrong in the request"
 	}
 }
 
-func checkCertificate(probeURL *url.URL) (probeResult, *x509.Certificate) {
-	checkLogger := log.WithFields(log.Fields{"probe_url": probeURL})
+// Reason returns a short machine readable representation of the result
+// to be used in metric labels and the JSON output
+func (p probeResult) Reason() string {
+	switch p {
+	case certificateOK:
+		return "ok"
+	case certificateExpiresSoon:
+		return "expires_soon"
+	case certificateExpiresCritical:
+		return "expires_critical"
+	case certificateRevoked:
+		return "revoked"
+	case certificateIntermediateRevoked:
+		return "intermediate_revoked"
+	case certificateCTPolicyFailed:
+		return "ct_policy_failed"
+	case certificateInvalid:
+		return "invalid"
+	case certificateNotFound:
+		return "hostname_mismatch"
+	case certificateExpired:
+		return "expired"
+	case certificateNotYetValid:
+		return "not_yet_valid"
+	case certificateUnknownAuthority:
+		return "unknown_authority"
+	case certificateSelfSigned:
+		return "self_signed"
+	case certificateInvalidIntermediate:
+		return "invalid_intermediate"
+	case connectionRefused:
+		return "connection_refused"
+	case connectionDNSFailure:
+		return "dns_failure"
+	case connectionTimeout:
+		return "connect_timeout"
+	case connectionHandshakeFailure:
+		return "handshake_failure"
+	case connectionHandshakeTimeout:
+		return "handshake_timeout"
+	case probeTimeout:
+		return "probe_timeout"
 
-	req, _ := http.NewRequest("HEAD", probeURL.String(), nil)
-	req.Header.Set("User-Agent", fmt.Sprintf("Mozilla/5.0 (compatible; PromCertcheck/%s; +https://github.com/Luzifer/promcertcheck)", version))
+	default:
+		return "general_failure"
+	}
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	switch {
-	case err == nil:
-	case strings.Contains(err.Error(), redirectFoundError.Error()):
-		checkLogger.WithError(err).Warn("A redirect was found")
+// severity ranks the result for aggregation of multiple results: The
+// higher the value the more severe the result is
+func (p probeResult) severity() int {
+	switch p {
+	case certificateOK:
+		return 0
+	case certificateExpiresSoon:
+		return 1
+	case certificateExpiresCritical:
+		return 2
 	default:
-		checkLogger.WithError(err).Error("HTTP request failed")
-		return generalFailure, nil
+		return 3
+	}
+}
+
+// critical returns whether the result needs immediate attention: All
+// failures and certificates within the critical expiry threshold are
+// critical while certificates within the warning threshold are not
+func (p probeResult) critical() bool {
+	return p.severity() >= certificateExpiresCritical.severity()
+}
+
+// validity returns the value to export as certificate validity metric
+func (p probeResult) validity() float64 {
+	if p == certificateOK || p == certificateExpiresSoon || p == certificateExpiresCritical {
+		return 1
 	}
-	resp.Body.Close()
+	return 0
+}
 
-	var (
-		intermediatePool = x509.NewCertPool()
-		verifyCert       *x509.Certificate
-	)
+// expiryThresholds define how long before the expiry of the certificate
+// a probe starts to warn about it and when it becomes critical
+type expiryThresholds struct {
+	Critical time.Duration
+	Warning  time.Duration
+}
 
-	hostPort := strings.Split(probeURL.Host, ":")
-	host := hostPort[0]
+// verificationOptions control which checks are executed in addition to
+// the verification of the chain
+type verificationOptions struct {
+	// CRL enables checking the certificates of the chain against the
+	// CRLs of their issuers
+	CRL bool
+	// CT enables verifying the Signed Certificate Timestamps of the
+	// certificate against the CT log list and policy
+	CT bool
+	// OCSP enables checking the stapled OCSP response or querying the
+	// OCSP responder
+	OCSP bool
+	// OCSPResponder overrides the responder named in the certificate
+	OCSPResponder string
+}
 
-	for _, cert := range resp.TLS.PeerCertificates {
-		wildHost := "*" + host[strings.Index(host, "."):]
-		if !str.StringInSlice(host, cert.DNSNames) && !str.StringInSlice(wildHost, cert.DNSNames) {
-			intermediatePool.AddCert(cert)
-			continue
-		}
+// checkCertificate fetches the certificates of the probe URL from the
+// address and verifies them. The expiry thresholds are applied to all
+// certificates of the verified chains, not only to the leaf.
+func checkCertificate(ctx context.Context, probeURL *url.URL, addr string, timeouts probeTimeouts, thresholds expiryThresholds, opts verificationOptions) *checkResult {
+	checkLogger := log.WithFields(log.Fields{"probe_url": probeURL, "address": addr})
 
-		verifyCert = cert
+	fetched, err := fetchCertificates(ctx, dialer{timeouts: timeouts}, probeURL, addr)
+	if err != nil {
+		checkLogger.WithError(err).Error("Connection to probe failed")
+		return newCheckResult(resultFromConnectionError(ctx, err), nil, nil)
 	}
 
-	if verifyCert == nil {
+	if len(fetched.Certificates) == 0 {
 		checkLogger.Debug("Certificate not found")
-		return certificateNotFound, nil
+		return newCheckResult(certificateNotFound, nil, nil)
 	}
 
-	verificationResult := false
-	if _, err := verifyCert.Verify(x509.VerifyOptions{
-		Intermediates: intermediatePool,
+	// The first certificate is the leaf, the others are its intermediates
+	// in the order sent by the server or stored in the file
+	verifyCert := fetched.Certificates[0]
+	verifyOpts := x509.VerifyOptions{
+		Intermediates: x509.NewCertPool(),
 		Roots:         rootPool,
-	}); err == nil {
-		verificationResult = true
 	}
+	for _, cert := range fetched.Certificates[1:] {
+		verifyOpts.Intermediates.AddCert(cert)
+	}
+
+	proto, _ := protocolForURL(probeURL)
+	switch {
+	case fetched.TrustAnchor:
+		// Trust anchors (like trusted keystore entries) are only checked
+		// for their validity period
+		verifyOpts.Roots = x509.NewCertPool()
+		verifyOpts.Roots.AddCert(verifyCert)
+
+	case proto.offline():
+		// There is no host to match the certificate against
+
+	case !matchesURISAN(verifyCert, probeURL):
+		// Verify DNS names (including wildcards) or IP addresses against
+		// the host of the probe URL
+		verifyOpts.DNSName = probeURL.Hostname()
+	}
+
+	chains, err := verifyCert.Verify(verifyOpts)
+	if err != nil {
+		checkLogger.WithError(err).Debug("Certificate invalid")
+		return newCheckResult(resultFromVerificationError(err, verifyCert), verifyCert, nil)
+	}
+
+	limitingCert := earliestExpiringCertificate(chains)
+	checkLogger = checkLogger.WithField("chain_expires_subject", limitingCert.Subject.CommonName)
 
-	if !verificationResult {
-		checkLogger.Debug("Certificate invalid")
-		return certificateInvalid, verifyCert
+	var ocspRes *ocspResult
+	if issuer := chainIssuer(chains); opts.OCSP && issuer != nil {
+		ocspRes = checkOCSP(ctx, verifyCert, issuer, fetched.OCSPResponse, !proto.offline(), opts)
 	}
 
-	if verifyCert.NotAfter.Sub(time.Now()) < cfg.ExpireWarning {
+	var crlResults []*crlResult
+	if opts.CRL {
+		crlResults = checkCRLs(ctx, chains[0])
+	}
+
+	var ctRes *ctResult
+	if opts.CT {
+		ctRes = checkCT(verifyCert, chainIssuer(chains), fetched.SignedCertificateTimestamps, ocspRes)
+	}
+
+	var (
+		remaining   = limitingCert.NotAfter.Sub(time.Now())
+		revokedCert = revokedByCRL(crlResults)
+		status      = certificateOK
+	)
+
+	switch {
+	case ocspRes != nil && ocspRes.Status == ocspStatusRevoked,
+		revokedCert != nil && revokedCert.Equal(verifyCert):
+		checkLogger.Debug("Certificate revoked")
+		status = certificateRevoked
+
+	case revokedCert != nil:
+		checkLogger.Debug("Intermediate certificate revoked")
+		status = certificateIntermediateRevoked
+
+	case ctRes != nil && !ctRes.Compliant:
+		checkLogger.Debug("Certificate does not comply with the CT policy")
+		status = certificateCTPolicyFailed
+
+	case remaining < thresholds.Critical:
+		checkLogger.Debug("Certificate expires very soon")
+		status = certificateExpiresCritical
+
+	case remaining < thresholds.Warning:
 		checkLogger.Debug("Certificate expires soon")
-		return certificateExpiresSoon, verifyCert
+		status = certificateExpiresSoon
+
+	default:
+		checkLogger.Debug("Certificate OK")
+	}
+
+	result := newCheckResult(status, verifyCert, limitingCert)
+	result.OCSP = ocspRes
+	result.CRL = crlResults
+	result.CT = ctRes
+	return result
+}
+
+// chainIssuer returns the issuer of the leaf in the first verified chain
+// or nil if the leaf is a trust anchor itself
+func chainIssuer(chains [][]*x509.Certificate) *x509.Certificate {
+	if len(chains) == 0 || len(chains[0]) < 2 {
+		return nil
+	}
+	return chains[0][1]
+}
+
+// earliestExpiringCertificate returns the certificate expiring first of
+// all certificates (leaf, intermediates and roots) in the chains. On
+// equal expiry the one closest to the leaf is returned.
+func earliestExpiringCertificate(chains [][]*x509.Certificate) *x509.Certificate {
+	var earliest *x509.Certificate
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if earliest == nil || cert.NotAfter.Before(earliest.NotAfter) {
+				earliest = cert
+			}
+		}
+	}
+	return earliest
+}
+
+// matchesURISAN returns whether one of the URI SANs of the certificate
+// identifies the service of the probe URL which requires scheme and host
+// to match (URI-ID of RFC 6125)
+func matchesURISAN(cert *x509.Certificate, probeURL *url.URL) bool {
+	host := strings.TrimSuffix(probeURL.Hostname(), ".")
+
+	for _, uri := range cert.URIs {
+		if strings.EqualFold(uri.Scheme, probeURL.Scheme) && strings.EqualFold(strings.TrimSuffix(uri.Hostname(), "."), host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// certificateNames returns all subject alternative names (DNS names, IP
+// addresses and URIs) of the certificate
+func certificateNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+// resultFromConnectionError maps errors from fetching the connection
+// state within the given context to the probe result describing the
+// failure
+func resultFromConnectionError(ctx context.Context, err error) probeResult {
+	var (
+		dnsErr       *net.DNSError
+		handshakeErr handshakeError
+		netErr       net.Error
+		opErr        *net.OpError
+	)
+
+	deadline, hasDeadline := ctx.Deadline()
+	isTimeout := errors.As(err, &netErr) && netErr.Timeout()
+
+	switch {
+	case errors.As(err, &dnsErr) && !dnsErr.IsTimeout:
+		return connectionDNSFailure
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return connectionRefused
+	case hasDeadline && !time.Now().Before(deadline):
+		// Whatever failed, the probe ran out of time
+		return probeTimeout
+	case errors.As(err, &handshakeErr) && isTimeout:
+		return connectionHandshakeTimeout
+	case errors.As(err, &handshakeErr):
+		return connectionHandshakeFailure
+	case errors.As(err, &opErr) && opErr.Op == "dial" && isTimeout:
+		return connectionTimeout
+	case isTimeout:
+		return probeTimeout
+	default:
+		return generalFailure
+	}
+}
+
+// resultFromVerificationError maps errors from the verification of the
+// leaf certificate to the probe result describing the failure
+func resultFromVerificationError(err error, leaf *x509.Certificate) probeResult {
+	var (
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+
+	switch {
+	case errors.As(err, &hostnameErr):
+		return certificateNotFound
+
+	case errors.As(err, &authorityErr):
+		if bytes.Equal(leaf.RawIssuer, leaf.RawSubject) && leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) == nil {
+			return certificateSelfSigned
+		}
+		return certificateUnknownAuthority
+
+	case errors.As(err, &invalidErr):
+		switch {
+		case invalidErr.Cert != nil && !invalidErr.Cert.Equal(leaf):
+			// Any failure of another certificate of the chain, including
+			// an expired intermediate while the leaf is still valid
+			return certificateInvalidIntermediate
+		case invalidErr.Reason == x509.Expired && time.Now().Before(invalidErr.Cert.NotBefore):
+			return certificateNotYetValid
+		case invalidErr.Reason == x509.Expired:
+			return certificateExpired
+		default:
+			return certificateInvalid
+		}
+
+	default:
+		return certificateInvalid
+	}
+}
+
+// parseCertificates reads all certificates from PEM encoded data or, if
+// the data contains no PEM blocks, from DER encoded data
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var (
+		certs []*x509.Certificate
+		rest  = data
+		isPEM bool
+	)
+
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		isPEM = true
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse certificate: %s", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if !isPEM && len(data) > 0 {
+		var err error
+		if certs, err = x509.ParseCertificates(data); err != nil {
+			return nil, fmt.Errorf("Unable to parse certificate: %s", err)
+		}
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("No certificate found")
 	}
 
-	checkLogger.Debug("Certificate OK")
-	return certificateOK, verifyCert
+	return certs, nil
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %s", err)
+	}
+
+	return key
+}
+
+func newTestCA(t *testing.T, name string) testCA {
+	t.Helper()
+
+	key := newTestKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+
+	return testCA{cert: createTestCertificate(t, tmpl, nil, key), key: key}
+}
+
+// issue creates a certificate signed by the CA, the template is
+// completed with a serial, a validity period and a key
+func (c testCA) issue(t *testing.T, serial int64, tmpl *x509.Certificate) testCA {
+	t.Helper()
+
+	key := newTestKey(t)
+	tmpl.SerialNumber = big.NewInt(serial)
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(24 * time.Hour)
+
+	return testCA{cert: createTestCertificate(t, tmpl, &c, key), key: key}
+}
+
+func createTestCertificate(t *testing.T, tmpl *x509.Certificate, parent *testCA, key *ecdsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+
+	parentCert, signer := tmpl, crypto.Signer(key)
+	if parent != nil {
+		parentCert, signer = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, key.Public(), signer)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %s", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Unable to parse certificate: %s", err)
+	}
+
+	return cert
+}
+
+func TestResultFromVerificationError(t *testing.T) {
+	root := newTestCA(t, "Test Root")
+	intermediate := root.issue(t, 2, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+
+	expiredIntermediate := intermediate
+	expiredIntermediate.cert = createTestCertificate(t, &x509.Certificate{
+		SerialNumber:          intermediate.cert.SerialNumber,
+		Subject:               intermediate.cert.Subject,
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(-24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, &root, intermediate.key)
+
+	leaf := intermediate.issue(t, 10, &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}, DNSNames: []string{"leaf.example.com"}}).cert
+
+	expiredLeaf := createTestCertificate(t, &x509.Certificate{
+		SerialNumber: leaf.SerialNumber,
+		Subject:      leaf.Subject,
+		DNSNames:     leaf.DNSNames,
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-24 * time.Hour),
+	}, &intermediate, newTestKey(t))
+
+	for _, tc := range []struct {
+		name         string
+		leaf         *x509.Certificate
+		intermediate *x509.Certificate
+		dnsName      string
+		result       probeResult
+	}{
+		{name: "expired intermediate", leaf: leaf, intermediate: expiredIntermediate.cert, result: certificateInvalidIntermediate},
+		{name: "expired leaf", leaf: expiredLeaf, intermediate: intermediate.cert, result: certificateExpired},
+		{name: "hostname mismatch", leaf: leaf, intermediate: intermediate.cert, dnsName: "other.example.com", result: certificateNotFound},
+		{name: "missing intermediate", leaf: leaf, result: certificateUnknownAuthority},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := x509.VerifyOptions{
+				DNSName:       tc.dnsName,
+				Intermediates: x509.NewCertPool(),
+				Roots:         x509.NewCertPool(),
+			}
+			opts.Roots.AddCert(root.cert)
+			if tc.intermediate != nil {
+				opts.Intermediates.AddCert(tc.intermediate)
+			}
+
+			_, err := tc.leaf.Verify(opts)
+			if err == nil {
+				t.Fatal("Expected verification to fail")
+			}
+
+			if result := resultFromVerificationError(err, tc.leaf); result != tc.result {
+				t.Errorf("Expected result %q, got %q (%s)", tc.result.Reason(), result.Reason(), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Luzifer/go_helpers/v2/str"
+	log "github.com/sirupsen/logrus"
+)
+
+// certFileExtensions are the extensions of files read when scanning
+// directories for certificates
+var certFileExtensions = []string{".cer", ".crt", ".der", ".pem"}
+
+// certFilesConfig describes local files to discover probes from: Every
+// file matching the paths and containing certificates is checked
+type certFilesConfig struct {
+	// Paths contains files, directories (scanned recursively for files
+	// with the certFileExtensions) or glob patterns of those
+	Paths []string `yaml:"paths"`
+	// RefreshInterval defines how often to scan the paths for files
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	probeModule `yaml:",inline"`
+}
+
+// certFilesDiscoverer scans the paths of the config for certificates
+type certFilesDiscoverer struct {
+	config certFilesConfig
+}
+
+func (c certFilesConfig) validate() error {
+	if len(c.Paths) == 0 {
+		return errors.New("No paths given")
+	}
+
+	for _, pattern := range c.Paths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid path pattern %q: %s", pattern, err)
+		}
+	}
+
+	if c.RefreshInterval < 0 {
+		return fmt.Errorf("Invalid refresh_interval %q: must be positive", c.RefreshInterval)
+	}
+
+	return c.probeModule.validateDiscovery()
+}
+
+func (c certFilesConfig) refreshInterval() time.Duration { return c.RefreshInterval }
+
+func (c certFilesConfig) discoverer() (discoverer, error) {
+	return certFilesDiscoverer{config: c}, nil
+}
+
+func (c certFilesDiscoverer) discover(ctx context.Context) ([]probeDefinition, error) {
+	var files []string
+
+	for _, pattern := range c.config.Paths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid path pattern %q: %s", pattern, err)
+		}
+
+		for _, match := range matches {
+			found, err := findFilesWithExtension(match, certFileExtensions)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, found...)
+		}
+	}
+
+	sort.Strings(files)
+
+	var (
+		defs []probeDefinition
+		seen = map[string]bool{}
+	)
+
+	for _, file := range files {
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+
+		if data, err := ioutil.ReadFile(file); err != nil || !containsCertificate(data) {
+			// Private keys, unrelated files, ... are not probed
+			log.WithFields(log.Fields{"file": file}).Debug("Skipping file without certificates")
+			continue
+		}
+
+		defs = append(defs, c.config.discoveredDefinition(certFileURL(file), nil))
+	}
+
+	return defs, nil
+}
+
+// findFilesWithExtension returns the file itself or all files having one
+// of the extensions in the directory and its sub-directories
+func findFilesWithExtension(path string, extensions []string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && str.StringInSlice(strings.ToLower(filepath.Ext(file)), extensions) {
+			files = append(files, file)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+func containsCertificate(data []byte) bool {
+	_, err := parseCertificates(data)
+	return err == nil
+}
+
+// certFileURL returns the probe URL for the file
+func certFileURL(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(file)}).String()
+}
+
+// readFileCertificates reads the certificates from the file given as
+// file:///<path>, the first certificate in the file is checked and the
+// others are used as intermediates
+func readFileCertificates(ctx context.Context, probeURL *url.URL) (*fetchResult, error) {
+	data, err := ioutil.ReadFile(filepath.FromSlash(probeURL.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read certificates from %q: %s", probeURL.Path, err)
+	}
+
+	return &fetchResult{Certificates: certs}, nil
+}
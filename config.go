@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the content of the file given by --config. JSON files
+// can be used as well as JSON is a subset of YAML.
+type configFile struct {
+	CertFiles  []certFilesConfig      `yaml:"cert_files"`
+	Consul     []consulConfig         `yaml:"consul"`
+	DNSSRV     []dnsSRVConfig         `yaml:"dns_srv"`
+	FileSD     []fileSDConfig         `yaml:"file_sd"`
+	Keystores  []keystoreConfig       `yaml:"keystores"`
+	Kubernetes []kubernetesConfig     `yaml:"kubernetes"`
+	Modules    map[string]probeModule `yaml:"modules"`
+	Probes     []probeDefinition      `yaml:"probes"`
+}
+
+// probeModule contains the settings applied to targets checked through
+// the /probe endpoint
+type probeModule struct {
+	// Protocol overrides the scheme of the target or is used as scheme
+	// if the target does not contain one
+	Protocol string `yaml:"protocol"`
+
+	probeOptions `yaml:",inline"`
+}
+
+// probeDefinition describes a single probe: The URL to check and the
+// options to apply to it which take precedence over the options given
+// in the fragment of the URL.
+type probeDefinition struct {
+	URL string `yaml:"url"`
+	// Protocol overrides the scheme of the URL or is used as scheme if
+	// the URL does not contain one
+	Protocol string `yaml:"protocol"`
+
+	probeOptions `yaml:",inline"`
+}
+
+func loadConfigFile(filename string) (*configFile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open config file: %s", err)
+	}
+	defer f.Close()
+
+	var (
+		config  = &configFile{}
+		decoder = yaml.NewDecoder(f)
+	)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("Unable to parse config file: %s", err)
+	}
+
+	for name, module := range config.Modules {
+		if err := module.validate(); err != nil {
+			return nil, fmt.Errorf("Module %q: %s", name, err)
+		}
+	}
+
+	for i, sd := range config.FileSD {
+		if err := sd.validate(); err != nil {
+			return nil, fmt.Errorf("File SD #%d: %s", i+1, err)
+		}
+	}
+
+	for i, c := range config.CertFiles {
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("Cert files #%d: %s", i+1, err)
+		}
+	}
+
+	for i, c := range config.Consul {
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("Consul #%d: %s", i+1, err)
+		}
+	}
+
+	for i, d := range config.DNSSRV {
+		if err := d.validate(); err != nil {
+			return nil, fmt.Errorf("DNS SRV #%d: %s", i+1, err)
+		}
+	}
+
+	for i, k := range config.Keystores {
+		if err := k.validate(); err != nil {
+			return nil, fmt.Errorf("Keystore #%d: %s", i+1, err)
+		}
+	}
+
+	for i, k := range config.Kubernetes {
+		if err := k.validate(); err != nil {
+			return nil, fmt.Errorf("Kubernetes #%d: %s", i+1, err)
+		}
+	}
+
+	for i, def := range config.Probes {
+		if _, err := probeFromDefinition(def); err != nil {
+			return nil, fmt.Errorf("Probe #%d (%s): %s", i+1, def.URL, err)
+		}
+	}
+
+	return config, nil
+}
+
+// discoverySources returns the configured discovery sources polling
+// external systems by a unique name
+func (c configFile) discoverySources() map[string]discoveryConfig {
+	sources := map[string]discoveryConfig{}
+
+	for i, files := range c.CertFiles {
+		sources[fmt.Sprintf("cert_files#%d", i+1)] = files
+	}
+
+	for i, consul := range c.Consul {
+		sources[fmt.Sprintf("consul#%d", i+1)] = consul
+	}
+
+	for i, d := range c.DNSSRV {
+		sources[fmt.Sprintf("dns_srv#%d", i+1)] = d
+	}
+
+	for i, k := range c.Keystores {
+		sources[fmt.Sprintf("keystores#%d", i+1)] = k
+	}
+
+	for i, k := range c.Kubernetes {
+		sources[fmt.Sprintf("kubernetes#%d", i+1)] = k
+	}
+
+	return sources
+}
+
+func (m probeModule) validate() error {
+	if _, ok := probeProtocols[m.Protocol]; m.Protocol != "" && !ok {
+		return fmt.Errorf("Unsupported probe protocol %q", m.Protocol)
+	}
+	return m.probeOptions.validate()
+}
+
+// probeDefinition returns the definition of a probe for the target
+// using the settings of the module
+func (m probeModule) probeDefinition(target string) probeDefinition {
+	return probeDefinition{
+		URL:          target,
+		Protocol:     m.Protocol,
+		probeOptions: m.probeOptions,
+	}
+}
+
+// probeURL returns the URL of the definition with the protocol applied
+func (d probeDefinition) probeURL() string {
+	if d.Protocol == "" {
+		return d.URL
+	}
+
+	if idx := strings.Index(d.URL, "://"); idx >= 0 {
+		return d.Protocol + d.URL[idx:]
+	}
+	return d.Protocol + "://" + d.URL
+}
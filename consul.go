@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Luzifer/go_helpers/v2/str"
+)
+
+const (
+	defaultConsulAddress = "http://127.0.0.1:8500"
+	defaultConsulTag     = "certcheck"
+	defaultConsulURLMeta = "certcheck_url"
+)
+
+var invalidLabelCharsRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// consulConfig describes a Consul agent to discover probes from: Every
+// instance of a service tagged with the tag is probed using the URL in
+// its metadata or its address and port.
+type consulConfig struct {
+	// Address is the URL of the Consul HTTP API
+	Address string `yaml:"address"`
+	// Datacenter to query, defaults to the datacenter of the agent
+	Datacenter string `yaml:"datacenter"`
+	// Token is the ACL token to authenticate with
+	Token string `yaml:"token"`
+
+	// PassingOnly skips instances with failing health checks
+	PassingOnly bool `yaml:"passing_only"`
+	// RefreshInterval defines how often to query the catalog
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// Tag marks the services to probe
+	Tag string `yaml:"tag"`
+	// URLMeta is the service metadata key containing the URL to probe
+	URLMeta string `yaml:"url_meta"`
+
+	probeModule `yaml:",inline"`
+}
+
+// consulServiceEntry is an entry of the health API response
+type consulServiceEntry struct {
+	Node struct {
+		Node    string
+		Address string
+	}
+	Service struct {
+		ID      string
+		Service string
+		Address string
+		Port    int
+		Meta    map[string]string
+	}
+}
+
+// consulDiscoverer queries the catalog and health API of Consul
+type consulDiscoverer struct {
+	address *url.URL
+	client  *http.Client
+	config  consulConfig
+}
+
+func (c consulConfig) validate() error {
+	if c.Address != "" {
+		if _, err := url.Parse(c.Address); err != nil {
+			return fmt.Errorf("Invalid address %q: %s", c.Address, err)
+		}
+	}
+
+	if c.RefreshInterval < 0 {
+		return fmt.Errorf("Invalid refresh_interval %q: must be positive", c.RefreshInterval)
+	}
+
+	return c.probeModule.validateDiscovery()
+}
+
+func (c consulConfig) refreshInterval() time.Duration { return c.RefreshInterval }
+
+func (c consulConfig) discoverer() (discoverer, error) {
+	if c.Address == "" {
+		c.Address = defaultConsulAddress
+	}
+	if c.Tag == "" {
+		c.Tag = defaultConsulTag
+	}
+	if c.URLMeta == "" {
+		c.URLMeta = defaultConsulURLMeta
+	}
+
+	address, err := url.Parse(c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid address: %s", err)
+	}
+
+	return consulDiscoverer{
+		address: address,
+		client:  &http.Client{},
+		config:  c,
+	}, nil
+}
+
+// get requests the given API path and decodes the JSON response
+func (c consulDiscoverer) get(ctx context.Context, apiPath string, query url.Values, v interface{}) error {
+	if c.config.Datacenter != "" {
+		query.Set("dc", c.config.Datacenter)
+	}
+
+	reqURL := *c.address
+	reqURL.Path = path.Join(reqURL.Path, apiPath)
+	reqURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	if c.config.Token != "" {
+		req.Header.Set("X-Consul-Token", c.config.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Consul responded with status %d for %q: %s", resp.StatusCode, apiPath, strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c consulDiscoverer) discover(ctx context.Context) ([]probeDefinition, error) {
+	// Service names with their tags
+	var services map[string][]string
+	if err := c.get(ctx, "/v1/catalog/services", url.Values{}, &services); err != nil {
+		return nil, fmt.Errorf("Unable to list services: %s", err)
+	}
+
+	var names []string
+	for name, tags := range services {
+		if str.StringInSlice(c.config.Tag, tags) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var (
+		defs []probeDefinition
+		seen = map[string]bool{}
+	)
+
+	for _, name := range names {
+		query := url.Values{"tag": {c.config.Tag}}
+		if c.config.PassingOnly {
+			query.Set("passing", "true")
+		}
+
+		var entries []consulServiceEntry
+		if err := c.get(ctx, path.Join("/v1/health/service", name), query, &entries); err != nil {
+			return nil, fmt.Errorf("Unable to list instances of service %q: %s", name, err)
+		}
+
+		for _, entry := range entries {
+			target := c.target(entry)
+			if target == "" || seen[target] {
+				// Instances of the same service might share the URL
+				continue
+			}
+			seen[target] = true
+
+			defs = append(defs, c.config.discoveredDefinition(target, c.labels(entry)))
+		}
+	}
+
+	return defs, nil
+}
+
+// target returns the URL from the service metadata or the address of
+// the service instance
+func (c consulDiscoverer) target(entry consulServiceEntry) string {
+	if u := entry.Service.Meta[c.config.URLMeta]; u != "" {
+		return u
+	}
+
+	host := entry.Service.Address
+	if host == "" {
+		// Service uses the address of the node
+		host = entry.Node.Address
+	}
+
+	if host == "" || entry.Service.Port == 0 {
+		return ""
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(entry.Service.Port))
+}
+
+// labels returns the labels for the service instance: The service
+// metadata with the names turned into valid label names
+func (c consulDiscoverer) labels(entry consulServiceEntry) map[string]string {
+	labels := map[string]string{
+		"consul_node":    entry.Node.Node,
+		"consul_service": entry.Service.Service,
+	}
+
+	for key, value := range entry.Service.Meta {
+		if key == c.config.URLMeta {
+			continue
+		}
+
+		name := invalidLabelCharsRegex.ReplaceAllString(key, "_")
+		if !labelNameRegex.MatchString(name) || str.StringInSlice(name, reservedLabelNames) {
+			// Would be rejected as probe label
+			continue
+		}
+		labels[name] = value
+	}
+
+	return labels
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	crlStatusGood    = "good"
+	crlStatusRevoked = "revoked"
+	crlStatusStale   = "stale"
+	crlStatusError   = "error"
+
+	// crlMaxSize limits the size of a CRL downloaded from a distribution
+	// point as the CRLs of public CAs can get quite large
+	crlMaxSize = 64 << 20
+
+	// crlMaxAge is how long a CRL without a next update is used before
+	// it is downloaded again
+	crlMaxAge = 24 * time.Hour
+)
+
+// crlStatuses are all values of the CRL status in the order of their
+// severity used to aggregate the status of the chain
+var crlStatuses = []string{crlStatusGood, crlStatusStale, crlStatusError, crlStatusRevoked}
+
+// crlResult holds the revocation status of one certificate of the chain
+// according to the CRL of its issuer
+type crlResult struct {
+	// Status is one of good, revoked, stale (the CRL is outdated or
+	// could not be refreshed) or error (no CRL could be obtained)
+	Status string
+	// Subject is the common name of the checked certificate
+	Subject    string
+	URL        string
+	ThisUpdate time.Time
+	NextUpdate time.Time
+	RevokedAt  time.Time
+	Error      string `json:",omitempty"`
+
+	cert *x509.Certificate
+}
+
+// cachedCRL is a downloaded CRL kept in memory and on disk
+type cachedCRL struct {
+	list *x509.RevocationList
+	// fetched is the time the CRL was downloaded
+	fetched time.Time
+	// fetchErr is the error of the last attempt to refresh the outdated
+	// CRL, the CRL is still used to check for revoked certificates
+	fetchErr error
+}
+
+var (
+	crlCache     = map[string]*cachedCRL{}
+	crlCacheLock sync.Mutex
+
+	// crlFetchLocks serialize the lookups of the same URL so concurrent
+	// probes wait for a running download instead of starting their own
+	crlFetchLocks = map[string]*sync.Mutex{}
+)
+
+// checkCRLs checks all certificates of the chain except the root
+// against the CRLs of their issuers
+func checkCRLs(ctx context.Context, chain []*x509.Certificate) []*crlResult {
+	var results []*crlResult
+
+	for i := 0; i < len(chain)-1; i++ {
+		if res := checkCRL(ctx, chain[i], chain[i+1]); res != nil {
+			results = append(results, res)
+		}
+	}
+
+	return results
+}
+
+// checkCRL checks the certificate against the CRL of its issuer taken
+// from the first reachable HTTP distribution point of the certificate
+func checkCRL(ctx context.Context, cert, issuer *x509.Certificate) *crlResult {
+	var urls []string
+	for _, dp := range cert.CRLDistributionPoints {
+		if strings.HasPrefix(dp, "http://") || strings.HasPrefix(dp, "https://") {
+			urls = append(urls, dp)
+		}
+	}
+
+	if len(urls) == 0 {
+		// Certificate does not support CRLs, there is nothing to check
+		return nil
+	}
+
+	logger := log.WithFields(log.Fields{"subject": cert.Subject.CommonName, "serial": cert.SerialNumber})
+	result := &crlResult{Status: crlStatusError, Subject: cert.Subject.CommonName, cert: cert}
+
+	for _, u := range urls {
+		result.URL = u
+
+		crl, err := getCRL(ctx, u)
+		if err == nil {
+			err = crl.list.CheckSignatureFrom(issuer)
+		}
+		if err != nil {
+			logger.WithField("url", u).WithError(err).Warn("Unable to get CRL")
+			result.Error = err.Error()
+			continue
+		}
+
+		result.Error = ""
+		result.ThisUpdate = crl.list.ThisUpdate
+		result.NextUpdate = crl.list.NextUpdate
+
+		switch entry := crl.revoked(cert); {
+		case entry != nil:
+			result.Status = crlStatusRevoked
+			result.RevokedAt = entry.RevocationTime
+
+		case crl.fetchErr != nil:
+			result.Status = crlStatusStale
+			result.Error = fmt.Sprintf("Unable to refresh CRL: %s", crl.fetchErr)
+
+		case crl.outdated():
+			result.Status = crlStatusStale
+			result.Error = fmt.Sprintf("CRL is outdated since %s", crl.list.NextUpdate)
+
+		default:
+			result.Status = crlStatusGood
+		}
+
+		return result
+	}
+
+	return result
+}
+
+// outdated returns whether the next update of the CRL is due
+func (c *cachedCRL) outdated() bool {
+	return !c.list.NextUpdate.IsZero() && c.list.NextUpdate.Before(time.Now())
+}
+
+// refreshDue returns whether the CRL needs to be downloaded again: CRLs
+// without a next update are refreshed after crlMaxAge
+func (c *cachedCRL) refreshDue() bool {
+	if c.list.NextUpdate.IsZero() {
+		return time.Since(c.fetched) > crlMaxAge
+	}
+	return c.outdated()
+}
+
+// revoked returns the entry of the certificate in the CRL or nil if the
+// certificate is not revoked
+func (c *cachedCRL) revoked(cert *x509.Certificate) *x509.RevocationListEntry {
+	for i := range c.list.RevokedCertificateEntries {
+		if c.list.RevokedCertificateEntries[i].SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return &c.list.RevokedCertificateEntries[i]
+		}
+	}
+	return nil
+}
+
+// getCRL returns the CRL from the given URL: Cached CRLs (in memory or
+// on disk) are used until their next update is due, outdated CRLs are
+// still returned when they cannot be refreshed
+func getCRL(ctx context.Context, u string) (*cachedCRL, error) {
+	fetchLock := crlFetchLock(u)
+	fetchLock.Lock()
+	defer fetchLock.Unlock()
+
+	crlCacheLock.Lock()
+	cached, ok := crlCache[u]
+	crlCacheLock.Unlock()
+
+	if !ok {
+		// Nothing in memory yet, use the copy stored by a previous run
+		if list, fetched, err := readCachedCRL(u); err == nil {
+			cached = &cachedCRL{list: list, fetched: fetched}
+		}
+	}
+
+	if cached != nil && !cached.refreshDue() {
+		return cached, nil
+	}
+
+	list, err := fetchCRL(ctx, u)
+	switch {
+	case err == nil:
+		cached = &cachedCRL{list: list, fetched: time.Now()}
+		if err = writeCachedCRL(u, list); err != nil {
+			log.WithField("url", u).WithError(err).Warn("Unable to store CRL in cache")
+		}
+
+	case cached != nil:
+		cached = &cachedCRL{list: cached.list, fetched: cached.fetched, fetchErr: err}
+
+	default:
+		return nil, err
+	}
+
+	crlCacheLock.Lock()
+	crlCache[u] = cached
+	crlCacheLock.Unlock()
+
+	return cached, nil
+}
+
+// crlFetchLock returns the lock to hold while looking up the CRL from
+// the given URL
+func crlFetchLock(u string) *sync.Mutex {
+	crlCacheLock.Lock()
+	defer crlCacheLock.Unlock()
+
+	lock, ok := crlFetchLocks[u]
+	if !ok {
+		lock = &sync.Mutex{}
+		crlFetchLocks[u] = lock
+	}
+	return lock
+}
+
+// fetchCRL downloads the CRL from the distribution point
+func fetchCRL(ctx context.Context, u string) (*x509.RevocationList, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create CRL request: %s", err)
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CRL distribution point returned status %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, crlMaxSize))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read CRL: %s", err)
+	}
+
+	return parseCRL(data)
+}
+
+// parseCRL parses a DER or PEM encoded CRL
+func parseCRL(data []byte) (*x509.RevocationList, error) {
+	if block, _ := pem.Decode(data); block != nil && block.Type == "X509 CRL" {
+		data = block.Bytes
+	}
+
+	list, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse CRL: %s", err)
+	}
+
+	return list, nil
+}
+
+// crlCacheFile returns the path of the file the CRL from the URL is
+// cached in
+func crlCacheFile(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(crlCacheDir(), hex.EncodeToString(sum[:])+".crl")
+}
+
+// crlCacheDir returns the directory to cache CRLs in
+func crlCacheDir() string {
+	if cfg.CRLCacheDir != "" {
+		return cfg.CRLCacheDir
+	}
+	return filepath.Join(os.TempDir(), "promcertcheck-crl")
+}
+
+// readCachedCRL reads the CRL from the cache directory and returns it
+// with the time it was stored
+func readCachedCRL(u string) (*x509.RevocationList, time.Time, error) {
+	info, err := os.Stat(crlCacheFile(u))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	data, err := ioutil.ReadFile(crlCacheFile(u))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	list, err := parseCRL(data)
+	return list, info.ModTime(), err
+}
+
+// writeCachedCRL stores the CRL atomically to not leave partial files
+// when the process is killed while writing
+func writeCachedCRL(u string, list *x509.RevocationList) error {
+	if err := os.MkdirAll(crlCacheDir(), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(crlCacheDir(), ".crl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(list.Raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), crlCacheFile(u))
+}
+
+// worstCRLStatus returns the most severe status of the results
+func worstCRLStatus(results []*crlResult) string {
+	worst := 0
+	for _, res := range results {
+		for i, status := range crlStatuses {
+			if res.Status == status && i > worst {
+				worst = i
+			}
+		}
+	}
+	return crlStatuses[worst]
+}
+
+// revokedByCRL returns the first certificate of the chain revoked by its
+// issuer or nil if none was revoked
+func revokedByCRL(results []*crlResult) *x509.Certificate {
+	for _, res := range results {
+		if res.Status == crlStatusRevoked {
+			return res.cert
+		}
+	}
+	return nil
+}
+
+// CRLStatus returns the worst CRL status of the certificates in the
+// chain for display in the overview
+func (c checkResult) CRLStatus() string {
+	return worstCRLStatus(c.CRL)
+}
+
+// earliestCRLUpdate returns the earliest next update of all CRLs
+func earliestCRLUpdate(results []*crlResult) time.Time {
+	var earliest time.Time
+	for _, res := range results {
+		if !res.NextUpdate.IsZero() && (earliest.IsZero() || res.NextUpdate.Before(earliest)) {
+			earliest = res.NextUpdate
+		}
+	}
+	return earliest
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestCRLServer starts a distribution point serving a CRL of the CA
+// with the given next update and counting the downloads
+func newTestCRLServer(t *testing.T, ca testCA, nextUpdate time.Time, downloads *int32) *httptest.Server {
+	t.Helper()
+
+	crl, err := x509.CreateRevocationList(nil, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: nextUpdate,
+	}, ca.cert, ca.key)
+	if err != nil {
+		t.Fatalf("Unable to create CRL: %s", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(downloads, 1)
+		// Keep the download running while the other lookups arrive
+		time.Sleep(50 * time.Millisecond)
+		w.Write(crl)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// useTestCRLCache points the CRL cache to an empty directory for the
+// duration of the test
+func useTestCRLCache(t *testing.T) {
+	cacheDir := cfg.CRLCacheDir
+	cfg.CRLCacheDir = t.TempDir()
+	t.Cleanup(func() { cfg.CRLCacheDir = cacheDir })
+}
+
+func TestGetCRLConcurrent(t *testing.T) {
+	useTestCRLCache(t)
+
+	var downloads int32
+	srv := newTestCRLServer(t, newTestCA(t, "Test CA"), time.Now().Add(time.Hour), &downloads)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := getCRL(context.Background(), srv.URL); err != nil {
+				t.Errorf("Unable to get CRL: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if downloads != 1 {
+		t.Errorf("Expected CRL to be downloaded once, got %d downloads", downloads)
+	}
+}
+
+func TestGetCRLWithoutNextUpdate(t *testing.T) {
+	useTestCRLCache(t)
+
+	var downloads int32
+	srv := newTestCRLServer(t, newTestCA(t, "Test CA"), time.Now().Add(time.Hour), &downloads)
+
+	crl, err := getCRL(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Unable to get CRL: %s", err)
+	}
+	// The next update is optional in CRLs but required when creating them
+	crl.list.NextUpdate = time.Time{}
+	if crl.outdated() {
+		t.Errorf("Expected CRL without next update not to be outdated")
+	}
+
+	if _, err = getCRL(context.Background(), srv.URL); err != nil {
+		t.Fatalf("Unable to get CRL: %s", err)
+	}
+	if downloads != 1 {
+		t.Fatalf("Expected cached CRL to be used, got %d downloads", downloads)
+	}
+
+	crl.fetched = time.Now().Add(-crlMaxAge - time.Minute)
+
+	if _, err = getCRL(context.Background(), srv.URL); err != nil {
+		t.Fatalf("Unable to get CRL: %s", err)
+	}
+	if downloads != 2 {
+		t.Errorf("Expected CRL to be downloaded again after the maximum age, got %d downloads", downloads)
+	}
+}
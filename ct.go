@@ -0,0 +1,464 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	casn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+const (
+	sctSourceEmbedded = "embedded"
+	sctSourceOCSP     = "ocsp"
+	sctSourceTLS      = "tls"
+
+	sctStatusValid        = "valid"
+	sctStatusInvalid      = "invalid"
+	sctStatusUnknownLog   = "unknown_log"
+	sctStatusUntrustedLog = "untrusted_log"
+
+	// Fields of the data signed by the log (RFC 6962, section 3.2)
+	sctVersion1        = 0
+	sctCertificateType = 0
+	ctEntryX509        = 0
+	ctEntryPrecert     = 1
+
+	// Algorithms of the SCT signature as defined for TLS (RFC 5246,
+	// section 7.4.1.4.1)
+	tlsHashSHA256     = 4
+	tlsSignatureRSA   = 1
+	tlsSignatureECDSA = 3
+)
+
+var (
+	// oidSCTList is the certificate extension containing the embedded
+	// SCTs (RFC 6962, section 3.3)
+	oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	// oidOCSPSCTList is the OCSP single response extension containing
+	// the SCTs (RFC 6962, section 3.3)
+	oidOCSPSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 5}
+
+	// ctLogs contains the logs of the CT log list by their log ID, it is
+	// nil if no log list is configured
+	ctLogs map[[sha256.Size]byte]*ctLog
+)
+
+// ctLog is a log of the CT log list
+type ctLog struct {
+	Description string
+	Key         crypto.PublicKey
+	Operator    string
+	// State is the state of the log in the log list (pending,
+	// qualified, usable, readonly, retired, rejected) which was entered
+	// at the StateTimestamp
+	State          string
+	StateTimestamp time.Time
+}
+
+// ctLogList is the v3 format of the CT log list as published at
+// https://www.gstatic.com/ct/log_list/v3/log_list.json
+type ctLogList struct {
+	Operators []struct {
+		Name      string           `json:"name"`
+		Logs      []ctLogListEntry `json:"logs"`
+		TiledLogs []ctLogListEntry `json:"tiled_logs"`
+	} `json:"operators"`
+}
+
+type ctLogListEntry struct {
+	Description string `json:"description"`
+	Key         []byte `json:"key"`
+	State       map[string]struct {
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"state"`
+}
+
+// ctResult holds the result of verifying the SCTs of a certificate
+// against the CT policy
+type ctResult struct {
+	// Compliant tells whether the valid SCTs fulfill the policy
+	// configured by the minimum number of SCTs and log operators
+	Compliant bool
+	// ValidSCTs is the number of distinct logs having issued a valid SCT
+	ValidSCTs int
+	// Operators is the number of distinct log operators of those logs
+	Operators int
+	SCTs      []*sctResult `json:",omitempty"`
+	Error     string       `json:",omitempty"`
+}
+
+// sctResult holds the verification result of a single SCT
+type sctResult struct {
+	// Source is one of embedded (certificate extension), tls (TLS
+	// extension) or ocsp (OCSP response extension)
+	Source string
+	// Status is one of valid, invalid, unknown_log (log not in the log
+	// list) or untrusted_log (log in a state not accepting the SCT)
+	Status    string
+	LogID     []byte
+	Log       string `json:",omitempty"`
+	Operator  string `json:",omitempty"`
+	Timestamp time.Time
+	Error     string `json:",omitempty"`
+}
+
+// signedCertificateTimestamp is a parsed SCT (RFC 6962, section 3.2)
+type signedCertificateTimestamp struct {
+	LogID              [sha256.Size]byte
+	Timestamp          uint64
+	Extensions         []byte
+	HashAlgorithm      uint8
+	SignatureAlgorithm uint8
+	Signature          []byte
+}
+
+// loadCTLogList reads the logs from a log list file in the v3 format
+func loadCTLogList(file string) (map[[sha256.Size]byte]*ctLog, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var list ctLogList
+	if err = json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("Unable to parse CT log list: %s", err)
+	}
+
+	logs := map[[sha256.Size]byte]*ctLog{}
+	for _, operator := range list.Operators {
+		for _, entry := range append(operator.Logs, operator.TiledLogs...) {
+			key, err := x509.ParsePKIXPublicKey(entry.Key)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse key of log %q: %s", entry.Description, err)
+			}
+
+			l := &ctLog{Description: entry.Description, Key: key, Operator: operator.Name}
+			for state, info := range entry.State {
+				l.State = state
+				l.StateTimestamp = info.Timestamp
+			}
+
+			// The log ID is defined as the hash of the key
+			logs[sha256.Sum256(entry.Key)] = l
+		}
+	}
+
+	if len(logs) == 0 {
+		return nil, errors.New("CT log list contains no logs")
+	}
+
+	return logs, nil
+}
+
+// accepts returns whether SCTs with the timestamp issued by the log are
+// accepted according to the state of the log
+func (l ctLog) accepts(timestamp time.Time) bool {
+	switch l.State {
+	case "qualified", "usable", "readonly":
+		return true
+	case "retired":
+		return timestamp.Before(l.StateTimestamp)
+	default:
+		return false
+	}
+}
+
+// checkCT verifies the SCTs embedded into the certificate, sent in the
+// TLS extension and contained in the OCSP response against the log list
+// and evaluates the policy. The issuer is required to verify embedded
+// SCTs, the OCSP result may be nil.
+func checkCT(cert, issuer *x509.Certificate, tlsSCTs [][]byte, ocspRes *ocspResult) *ctResult {
+	result := &ctResult{}
+
+	if ctLogs == nil {
+		result.Error = "No CT log list configured"
+		return result
+	}
+
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidSCTList) {
+			result.addSCTList(sctSourceEmbedded, ext.Value, cert, issuer)
+		}
+	}
+
+	for _, sct := range tlsSCTs {
+		result.SCTs = append(result.SCTs, verifySCT(sctSourceTLS, sct, cert, issuer))
+	}
+
+	if ocspRes != nil && ocspRes.sctList != nil {
+		result.addSCTList(sctSourceOCSP, ocspRes.sctList, cert, issuer)
+	}
+
+	var (
+		logs      = map[string]bool{}
+		operators = map[string]bool{}
+	)
+	for _, sct := range result.SCTs {
+		if sct.Status == sctStatusValid {
+			logs[string(sct.LogID)] = true
+			operators[sct.Operator] = true
+		}
+	}
+
+	result.ValidSCTs = len(logs)
+	result.Operators = len(operators)
+	result.Compliant = result.ValidSCTs >= cfg.CTMinSCTs && result.Operators >= cfg.CTMinOperators
+
+	return result
+}
+
+// addSCTList verifies all SCTs of the DER encoded SCT list extension
+func (c *ctResult) addSCTList(source string, value []byte, cert, issuer *x509.Certificate) {
+	scts, err := parseSCTList(value)
+	if err != nil {
+		c.SCTs = append(c.SCTs, &sctResult{Source: source, Status: sctStatusInvalid, Error: err.Error()})
+		return
+	}
+
+	for _, sct := range scts {
+		c.SCTs = append(c.SCTs, verifySCT(source, sct, cert, issuer))
+	}
+}
+
+// verifySCT checks the signature of the SCT using the key of the log it
+// was issued by and whether the log is trusted to issue it
+func verifySCT(source string, data []byte, cert, issuer *x509.Certificate) *sctResult {
+	result := &sctResult{Source: source, Status: sctStatusInvalid}
+
+	sct, err := parseSCT(data)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.LogID = sct.LogID[:]
+	result.Timestamp = time.Unix(0, int64(sct.Timestamp)*int64(time.Millisecond)).UTC()
+
+	l, ok := ctLogs[sct.LogID]
+	if !ok {
+		result.Status = sctStatusUnknownLog
+		return result
+	}
+	result.Log = l.Description
+	result.Operator = l.Operator
+
+	// Embedded SCTs were issued for the precertificate which is the
+	// certificate without the SCT extension bound to the issuer key
+	entry := &cryptobyte.Builder{}
+	entryType := uint16(ctEntryX509)
+	if source == sctSourceEmbedded {
+		if issuer == nil {
+			result.Error = "Issuer required to verify embedded SCT is unknown"
+			return result
+		}
+
+		tbs, err := removeSCTListExtension(cert.RawTBSCertificate)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+
+		issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		entryType = ctEntryPrecert
+		entry.AddBytes(issuerKeyHash[:])
+		entry.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(tbs) })
+	} else {
+		entry.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(cert.Raw) })
+	}
+
+	if err = sct.verify(l.Key, entryType, entry.BytesOrPanic()); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	switch {
+	case result.Timestamp.After(time.Now()):
+		result.Error = "SCT timestamp is in the future"
+
+	case !l.accepts(result.Timestamp):
+		result.Status = sctStatusUntrustedLog
+		result.Error = fmt.Sprintf("Log is %s", l.State)
+
+	default:
+		result.Status = sctStatusValid
+	}
+
+	return result
+}
+
+// parseSCTList parses the TLS encoded SCT list wrapped into an ASN.1
+// octet string as contained in certificate and OCSP extensions
+func parseSCTList(value []byte) ([][]byte, error) {
+	var octets []byte
+	if rest, err := asn1.Unmarshal(value, &octets); err != nil || len(rest) > 0 {
+		return nil, errors.New("Malformed SCT list extension")
+	}
+
+	var (
+		input = cryptobyte.String(octets)
+		list  cryptobyte.String
+		scts  [][]byte
+	)
+
+	if !input.ReadUint16LengthPrefixed(&list) || !input.Empty() {
+		return nil, errors.New("Malformed SCT list")
+	}
+
+	for !list.Empty() {
+		var sct cryptobyte.String
+		if !list.ReadUint16LengthPrefixed(&sct) {
+			return nil, errors.New("Malformed SCT list")
+		}
+		scts = append(scts, sct)
+	}
+
+	return scts, nil
+}
+
+// parseSCT parses a TLS encoded SCT of version 1
+func parseSCT(data []byte) (*signedCertificateTimestamp, error) {
+	var (
+		input      = cryptobyte.String(data)
+		sct        = &signedCertificateTimestamp{}
+		version    uint8
+		logID      []byte
+		extensions cryptobyte.String
+		signature  cryptobyte.String
+	)
+
+	if !input.ReadUint8(&version) {
+		return nil, errors.New("Malformed SCT")
+	}
+	if version != sctVersion1 {
+		return nil, fmt.Errorf("Unsupported SCT version %d", version)
+	}
+
+	if !input.ReadBytes(&logID, sha256.Size) ||
+		!input.ReadUint64(&sct.Timestamp) ||
+		!input.ReadUint16LengthPrefixed(&extensions) ||
+		!input.ReadUint8(&sct.HashAlgorithm) ||
+		!input.ReadUint8(&sct.SignatureAlgorithm) ||
+		!input.ReadUint16LengthPrefixed(&signature) ||
+		!input.Empty() {
+		return nil, errors.New("Malformed SCT")
+	}
+
+	copy(sct.LogID[:], logID)
+	sct.Extensions = extensions
+	sct.Signature = signature
+
+	return sct, nil
+}
+
+// verify checks the signature of the SCT over the given entry using the
+// key of the log
+func (s signedCertificateTimestamp) verify(key crypto.PublicKey, entryType uint16, entry []byte) error {
+	if s.HashAlgorithm != tlsHashSHA256 {
+		return fmt.Errorf("Unsupported SCT hash algorithm %d", s.HashAlgorithm)
+	}
+
+	b := &cryptobyte.Builder{}
+	b.AddUint8(sctVersion1)
+	b.AddUint8(sctCertificateType)
+	b.AddUint64(s.Timestamp)
+	b.AddUint16(entryType)
+	b.AddBytes(entry)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(s.Extensions) })
+
+	digest := sha256.Sum256(b.BytesOrPanic())
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if s.SignatureAlgorithm != tlsSignatureECDSA || !ecdsa.VerifyASN1(k, digest[:], s.Signature) {
+			return errors.New("Bad SCT signature")
+		}
+
+	case *rsa.PublicKey:
+		if s.SignatureAlgorithm != tlsSignatureRSA || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], s.Signature) != nil {
+			return errors.New("Bad SCT signature")
+		}
+
+	default:
+		return fmt.Errorf("Unsupported log key type %T", key)
+	}
+
+	return nil
+}
+
+// removeSCTListExtension returns the TBS certificate without the SCT list
+// extension which is the TBS certificate of the precertificate the
+// embedded SCTs were issued for (RFC 6962, section 3.2)
+func removeSCTListExtension(rawTBS []byte) ([]byte, error) {
+	var (
+		input = cryptobyte.String(rawTBS)
+		tbs   cryptobyte.String
+	)
+
+	if !input.ReadASN1(&tbs, casn1.SEQUENCE) {
+		return nil, errors.New("Malformed TBS certificate")
+	}
+
+	extensionsTag := casn1.Tag(3).Constructed().ContextSpecific()
+
+	b := &cryptobyte.Builder{}
+	b.AddASN1(casn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for !tbs.Empty() {
+			var (
+				element cryptobyte.String
+				tag     casn1.Tag
+			)
+			if !tbs.ReadAnyASN1Element(&element, &tag) {
+				b.SetError(errors.New("Malformed TBS certificate"))
+				return
+			}
+
+			if tag != extensionsTag {
+				b.AddBytes(element)
+				continue
+			}
+
+			var explicit, extensions cryptobyte.String
+			if !element.ReadASN1(&explicit, extensionsTag) || !explicit.ReadASN1(&extensions, casn1.SEQUENCE) {
+				b.SetError(errors.New("Malformed certificate extensions"))
+				return
+			}
+
+			b.AddASN1(extensionsTag, func(b *cryptobyte.Builder) {
+				b.AddASN1(casn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					for !extensions.Empty() {
+						var (
+							extension, body cryptobyte.String
+							oid             asn1.ObjectIdentifier
+						)
+						if !extensions.ReadASN1Element(&extension, casn1.SEQUENCE) {
+							b.SetError(errors.New("Malformed certificate extension"))
+							return
+						}
+
+						body = extension
+						if !body.ReadASN1(&body, casn1.SEQUENCE) || !body.ReadASN1ObjectIdentifier(&oid) {
+							b.SetError(errors.New("Malformed certificate extension"))
+							return
+						}
+
+						if !oid.Equal(oidSCTList) {
+							b.AddBytes(extension)
+						}
+					}
+				})
+			})
+		}
+	})
+
+	return b.Bytes()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+const (
+	// https://www.postgresql.org/docs/current/protocol-message-formats.html (SSLRequest)
+	postgresSSLRequestCode = 80877103
+
+	// https://dev.mysql.com/doc/dev/mysql-server/latest/group__group__cs__capabilities__flags.html
+	mysqlClientProtocol41       = 0x00000200
+	mysqlClientSSL              = 0x00000800
+	mysqlClientSecureConnection = 0x00008000
+	mysqlCharsetUTF8MB4         = 45
+	mysqlMaxPacketSize          = 1<<24 - 1
+	mysqlProtocolVersion        = 10
+)
+
+func fetchPostgresConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error) {
+	conn, err := d.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	sslRequest := make([]byte, 8)
+	binary.BigEndian.PutUint32(sslRequest[0:4], uint32(len(sslRequest)))
+	binary.BigEndian.PutUint32(sslRequest[4:8], postgresSSLRequestCode)
+
+	if _, err = conn.Write(sslRequest); err != nil {
+		return nil, fmt.Errorf("Unable to send SSLRequest: %s", err)
+	}
+
+	resp := make([]byte, 1)
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		return nil, fmt.Errorf("Unable to read SSLRequest response: %s", err)
+	}
+
+	switch resp[0] {
+	case 'S':
+		return d.tlsClient(ctx, conn, probeURL.Hostname())
+	case 'N':
+		return nil, fmt.Errorf("Server does not support SSL")
+	default:
+		return nil, fmt.Errorf("Unexpected SSLRequest response %q", resp[0])
+	}
+}
+
+func fetchMySQLConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error) {
+	conn, err := d.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	seq, handshake, err := readMySQLPacket(conn)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read initial handshake: %s", err)
+	}
+
+	capabilities, err := parseMySQLCapabilities(handshake)
+	if err != nil {
+		return nil, err
+	}
+
+	if capabilities&mysqlClientSSL == 0 {
+		return nil, fmt.Errorf("Server does not support SSL")
+	}
+
+	// SSLRequest is a shortened HandshakeResponse41 packet: capability
+	// flags, max packet size, character set and 23 bytes of filler
+	sslRequest := make([]byte, 32)
+	binary.LittleEndian.PutUint32(sslRequest[0:4], mysqlClientProtocol41|mysqlClientSSL|mysqlClientSecureConnection)
+	binary.LittleEndian.PutUint32(sslRequest[4:8], mysqlMaxPacketSize)
+	sslRequest[8] = mysqlCharsetUTF8MB4
+
+	if err = writeMySQLPacket(conn, seq+1, sslRequest); err != nil {
+		return nil, fmt.Errorf("Unable to send SSLRequest: %s", err)
+	}
+
+	return d.tlsClient(ctx, conn, probeURL.Hostname())
+}
+
+// parseMySQLCapabilities extracts the capability flags from the
+// protocol version 10 initial handshake packet
+func parseMySQLCapabilities(handshake []byte) (uint32, error) {
+	if len(handshake) > 0 && handshake[0] == 0xff {
+		// Error packet: 0xff, 2 byte error code, human readable message
+		if len(handshake) < 3 {
+			return 0, fmt.Errorf("Server sent malformed error packet")
+		}
+		return 0, fmt.Errorf("Server sent error %d: %s", binary.LittleEndian.Uint16(handshake[1:3]), handshake[3:])
+	}
+
+	if len(handshake) == 0 || handshake[0] != mysqlProtocolVersion {
+		return 0, fmt.Errorf("Unsupported protocol version in initial handshake")
+	}
+
+	// Skip protocol version and NUL terminated server version
+	pos := 1
+	for pos < len(handshake) && handshake[pos] != 0 {
+		pos++
+	}
+	// NUL byte, connection id (4), auth-plugin-data-part-1 (8), filler (1)
+	pos += 1 + 4 + 8 + 1
+
+	if len(handshake) < pos+2 {
+		return 0, fmt.Errorf("Initial handshake is too short")
+	}
+	capabilities := uint32(binary.LittleEndian.Uint16(handshake[pos : pos+2]))
+
+	// Character set (1), status flags (2), upper capability flags (2)
+	pos += 2 + 1 + 2
+	if len(handshake) >= pos+2 {
+		capabilities |= uint32(binary.LittleEndian.Uint16(handshake[pos:pos+2])) << 16
+	}
+
+	return capabilities, nil
+}
+
+func readMySQLPacket(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+
+	return header[3], payload, nil
+}
+
+func writeMySQLPacket(w io.Writer, seq byte, payload []byte) error {
+	length := len(payload)
+	packet := append([]byte{byte(length), byte(length >> 8), byte(length >> 16), seq}, payload...)
+
+	_, err := w.Write(packet)
+	return err
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultDiscoveryInterval is used for discovery sources not specifying
+// a refresh interval
+const defaultDiscoveryInterval = 5 * time.Minute
+
+// discoveryConfig is the configuration of a discovery source polling
+// an external system for probes
+type discoveryConfig interface {
+	// discoverer creates the discoverer for the configuration
+	discoverer() (discoverer, error)
+	// refreshInterval returns how often to poll the source
+	refreshInterval() time.Duration
+}
+
+// discoverer fetches the definitions of the probes currently known to
+// an external system
+type discoverer interface {
+	discover(ctx context.Context) ([]probeDefinition, error)
+}
+
+// discoveryRunner polls a discovery source in its refresh interval and
+// keeps the last successfully discovered probe definitions
+type discoveryRunner struct {
+	config discoveryConfig
+	name   string
+	source discoverer
+
+	defs     []probeDefinition
+	defsLock sync.RWMutex
+
+	done chan struct{}
+}
+
+var discoveryRunners = map[string]*discoveryRunner{}
+
+// updateDiscoveryRunners starts runners for new sources, restarts those
+// with a changed config and stops the runners of removed sources. Must
+// only be called while holding the syncProbesLock.
+func updateDiscoveryRunners(configs map[string]discoveryConfig) error {
+	for name, runner := range discoveryRunners {
+		if config, ok := configs[name]; ok && reflect.DeepEqual(config, runner.config) {
+			continue
+		}
+
+		close(runner.done)
+		delete(discoveryRunners, name)
+		log.WithFields(log.Fields{"source": name}).Info("Discovery source stopped")
+	}
+
+	for name, config := range configs {
+		if _, ok := discoveryRunners[name]; ok {
+			continue
+		}
+
+		source, err := config.discoverer()
+		if err != nil {
+			return fmt.Errorf("Unable to create discovery source %q: %s", name, err)
+		}
+
+		runner := &discoveryRunner{
+			config: config,
+			name:   name,
+			source: source,
+			done:   make(chan struct{}),
+		}
+		discoveryRunners[name] = runner
+		go runner.run()
+
+		log.WithFields(log.Fields{"source": name}).Info("Discovery source started")
+	}
+
+	return nil
+}
+
+// discoveredDefinitions returns the probe definitions of all running
+// discovery sources. Must only be called while holding the
+// syncProbesLock.
+func discoveredDefinitions() []probeDefinition {
+	var names []string
+	for name := range discoveryRunners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var defs []probeDefinition
+	for _, name := range names {
+		defs = append(defs, discoveryRunners[name].definitions()...)
+	}
+
+	return defs
+}
+
+func (d *discoveryRunner) run() {
+	interval := d.config.refreshInterval()
+	if interval <= 0 {
+		interval = defaultDiscoveryInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		d.refresh(interval)
+
+		select {
+		case <-ticker.C:
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// refresh polls the source and triggers a reload of the probes when the
+// discovered probes changed. On errors the previously discovered probes
+// are kept.
+func (d *discoveryRunner) refresh(timeout time.Duration) {
+	logger := log.WithFields(log.Fields{"source": d.name})
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	defs, err := d.source.discover(ctx)
+	if err != nil {
+		logger.WithError(err).Error("Unable to discover probes, keeping previous probes")
+		return
+	}
+
+	d.defsLock.Lock()
+	changed := !reflect.DeepEqual(defs, d.defs)
+	d.defs = defs
+	d.defsLock.Unlock()
+
+	logger.WithFields(log.Fields{"probes": len(defs)}).Debug("Probes discovered")
+
+	select {
+	case <-d.done:
+		// Source was stopped while discovering
+		return
+	default:
+	}
+
+	if changed {
+		reloadProbes(d.name)
+	}
+}
+
+func (d *discoveryRunner) definitions() []probeDefinition {
+	d.defsLock.RLock()
+	defer d.defsLock.RUnlock()
+
+	return d.defs
+}
+
+// validateDiscovery validates the module to be used for discovered
+// targets
+func (m probeModule) validateDiscovery() error {
+	if m.Name != "" {
+		return errors.New("Option name can't be used for multiple targets")
+	}
+	return m.validate()
+}
+
+// discoveredDefinition returns the probe definition for a discovered
+// target using the settings of the module and the labels attached to
+// the target by the discovery source
+func (m probeModule) discoveredDefinition(target string, targetLabels map[string]string) probeDefinition {
+	def := m.probeDefinition(target)
+	if def.Protocol == "" && !strings.Contains(target, "://") {
+		// Discovered targets are commonly given as host:port
+		def.Protocol = "https"
+	}
+
+	labels := map[string]string{}
+	for name, value := range m.Labels {
+		labels[name] = value
+	}
+	for name, value := range targetLabels {
+		if strings.HasPrefix(name, "__") {
+			// Meta labels are not meant to be exported
+			continue
+		}
+		labels[name] = value
+	}
+	def.Labels = labels
+
+	return def
+}
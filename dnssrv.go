@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// srvServiceProtocols maps the service of SRV names to the protocol to
+// probe the targets with. Services not listed (like the plaintext _sip)
+// can only be discovered with an explicitly configured protocol.
+var srvServiceProtocols = map[string]string{
+	"_https":        "https",
+	"_imap":         "imap",
+	"_imaps":        "imaps",
+	"_ldap":         "ldap",
+	"_ldaps":        "ldaps",
+	"_pop3":         "pop3",
+	"_pop3s":        "pop3s",
+	"_postgresql":   "postgres",
+	"_sieve":        "sieve",
+	"_sips":         "tls",
+	"_submission":   "submission",
+	"_submissions":  "smtps",
+	"_xmpp-client":  "xmpp",
+	"_xmpp-server":  "xmpp-server",
+	"_xmpps-client": "tls",
+	"_xmpps-server": "tls",
+}
+
+// dnsSRVConfig describes SRV records to discover probes from: Every
+// target / port pair of the records is probed
+type dnsSRVConfig struct {
+	// Names of the SRV records (_xmpps-client._tcp.example.com)
+	Names []string `yaml:"names"`
+	// RefreshInterval defines how often to resolve the records
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// Resolver is the host:port of the DNS server to query instead of
+	// the system resolver
+	Resolver string `yaml:"resolver"`
+	// VerifyTarget verifies the certificates against the target host of
+	// the records instead of the domain of the SRV name
+	VerifyTarget bool `yaml:"verify_target"`
+
+	probeModule `yaml:",inline"`
+}
+
+// dnsSRVDiscoverer resolves the SRV records of the config
+type dnsSRVDiscoverer struct {
+	config   dnsSRVConfig
+	resolver *net.Resolver
+}
+
+func (d dnsSRVConfig) validate() error {
+	if len(d.Names) == 0 {
+		return errors.New("No names given")
+	}
+
+	for _, name := range d.Names {
+		if srvDomain(name) == "" {
+			return fmt.Errorf("Invalid SRV name %q", name)
+		}
+		if d.Protocol == "" && srvProtocol(name) == "" {
+			return fmt.Errorf("No protocol known for the service of %q, protocol needs to be set", name)
+		}
+	}
+
+	if d.RefreshInterval < 0 {
+		return fmt.Errorf("Invalid refresh_interval %q: must be positive", d.RefreshInterval)
+	}
+
+	if d.Resolver != "" {
+		if _, _, err := net.SplitHostPort(d.Resolver); err != nil {
+			return fmt.Errorf("Invalid resolver %q: %s", d.Resolver, err)
+		}
+	}
+
+	return d.probeModule.validateDiscovery()
+}
+
+func (d dnsSRVConfig) refreshInterval() time.Duration { return d.RefreshInterval }
+
+func (d dnsSRVConfig) discoverer() (discoverer, error) {
+	resolver := net.DefaultResolver
+	if d.Resolver != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, d.Resolver)
+			},
+		}
+	}
+
+	return dnsSRVDiscoverer{config: d, resolver: resolver}, nil
+}
+
+func (d dnsSRVDiscoverer) discover(ctx context.Context) ([]probeDefinition, error) {
+	var (
+		defs []probeDefinition
+		seen = map[string]bool{}
+	)
+
+	for _, name := range d.config.Names {
+		_, records, err := d.resolver.LookupSRV(ctx, "", "", name)
+
+		var dnsErr *net.DNSError
+		switch {
+		case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+			// Record was removed, there is nothing to probe
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("Unable to resolve %q: %s", name, err)
+		}
+
+		sort.Slice(records, func(i, j int) bool {
+			if records[i].Target != records[j].Target {
+				return records[i].Target < records[j].Target
+			}
+			return records[i].Port < records[j].Port
+		})
+
+		for _, record := range records {
+			host := strings.TrimSuffix(record.Target, ".")
+			if host == "" {
+				// Target "." marks the service as not available
+				continue
+			}
+
+			target := net.JoinHostPort(host, strconv.Itoa(int(record.Port)))
+
+			def := d.config.discoveredDefinition(target, map[string]string{"srv_name": name})
+			if d.config.Protocol == "" {
+				def.Protocol = srvProtocol(name)
+			}
+			if !d.config.VerifyTarget && def.ServerName == "" {
+				// Clients verify the domain they were asked to connect to
+				// (RFC 6125, section 6.2.1), not the target of the record
+				def.ServerName = srvDomain(name)
+			}
+
+			if key := def.ServerName + "@" + target; !seen[key] {
+				seen[key] = true
+				defs = append(defs, def)
+			}
+		}
+	}
+
+	return defs, nil
+}
+
+// srvProtocol returns the protocol to probe the targets of the SRV name
+// with based on the service in the name or an empty string if the
+// service is unknown
+func srvProtocol(name string) string {
+	return srvServiceProtocols[strings.SplitN(name, ".", 2)[0]]
+}
+
+// srvDomain returns the domain of the SRV name (example.com for
+// _xmpp-client._tcp.example.com) or an empty string if the name does not
+// contain service and protocol
+func srvDomain(name string) string {
+	parts := strings.SplitN(strings.TrimSuffix(name, "."), ".", 3)
+	if len(parts) < 3 || !strings.HasPrefix(parts[0], "_") || !strings.HasPrefix(parts[1], "_") {
+		return ""
+	}
+	return parts[2]
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultModuleName is the module used for /probe requests not
+// specifying a module
+const defaultModuleName = "default"
+
+var (
+	probeModules     = map[string]probeModule{}
+	probeModulesLock sync.RWMutex
+)
+
+// setProbeModules replaces the modules available to the /probe endpoint
+func setProbeModules(modules map[string]probeModule) {
+	probeModulesLock.Lock()
+	defer probeModulesLock.Unlock()
+
+	probeModules = modules
+}
+
+// getProbeModule returns the module with the given name. The default
+// module is available without options if not configured.
+func getProbeModule(name string) (probeModule, bool) {
+	probeModulesLock.RLock()
+	defer probeModulesLock.RUnlock()
+
+	if name == "" {
+		name = defaultModuleName
+	}
+
+	module, ok := probeModules[name]
+	if !ok && name == defaultModuleName {
+		return probeModule{}, true
+	}
+
+	return module, ok
+}
+
+// probeHandler checks the target given in the request using the given
+// module and responds with the metrics of that check only. This allows
+// Prometheus to select the targets to check through its service
+// discovery and relabeling (multi-target exporter pattern).
+func probeHandler(res http.ResponseWriter, r *http.Request) {
+	var (
+		moduleName = r.URL.Query().Get("module")
+		target     = r.URL.Query().Get("target")
+	)
+
+	if target == "" {
+		http.Error(res, "Parameter target is missing", http.StatusBadRequest)
+		return
+	}
+
+	module, ok := getProbeModule(moduleName)
+	if !ok {
+		http.Error(res, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+
+	p, err := probeFromDefinition(module.probeDefinition(target))
+	if err != nil {
+		http.Error(res, fmt.Sprintf("Unable to create probe: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if proto, _ := protocolForURL(p.url); proto.offline() {
+		// Reading local files, keystores or Secrets is only possible
+		// through the config file, not for anyone able to reach the endpoint
+		http.Error(res, fmt.Sprintf("Protocol %q can not be used on this endpoint", p.url.Scheme), http.StatusBadRequest)
+		return
+	}
+
+	logger := log.WithFields(log.Fields{"host": p.name, "module": moduleName})
+
+	start := time.Now()
+	if err := p.refresh(); err != nil {
+		logger.WithError(err).Error("Unable to check probe")
+		http.Error(res, fmt.Sprintf("Unable to check probe: %s", err), http.StatusInternalServerError)
+		return
+	}
+	duration := time.Since(start)
+
+	logger.WithFields(log.Fields{"duration": duration}).Debug("Target checked")
+
+	// Use a store containing only the checked probe to export the same
+	// metrics as for the probes registered at startup
+	store := newProbeStore()
+	if err := store.Add(p); err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "certcheck_probe_duration_seconds",
+		Help: "Duration of the check of the target in seconds",
+	})
+	probeDuration.Set(duration.Seconds())
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeCollector{store: store}, probeDuration)
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(res, r)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// connectionStateFetcher connects to the given address using the dialer,
+// executes the protocol specific TLS handshake for the probe URL and
+// returns the resulting connection state. The fetcher must return when
+// the context is done.
+type connectionStateFetcher func(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error)
+
+// certificateReader reads the certificates of the probe URL from storage
+// and returns them as fetch result
+type certificateReader func(ctx context.Context, probeURL *url.URL) (*fetchResult, error)
+
+type probeProtocol struct {
+	DefaultPort string
+	Fetch       connectionStateFetcher
+	// Read is used instead of Fetch by offline protocols reading the
+	// certificates from storage instead of a connection to the host: The
+	// certificates are not verified against the host of the URL.
+	Read certificateReader
+}
+
+// fetchResult contains the certificates to check for a probe
+type fetchResult struct {
+	// Certificates contains the leaf first followed by its intermediates
+	Certificates []*x509.Certificate
+	// TrustAnchor marks the leaf as trusted by definition (like trusted
+	// keystore entries), it is only checked for its validity period
+	TrustAnchor bool
+
+	// OCSPResponse and SignedCertificateTimestamps are the ones sent
+	// during the TLS handshake
+	OCSPResponse                []byte
+	SignedCertificateTimestamps [][]byte
+}
+
+var probeProtocols = map[string]probeProtocol{
+	"https": {DefaultPort: "443", Fetch: fetchHTTPSConnectionState},
+
+	// Handshake only protocols not sending any application data
+	"imaps": {DefaultPort: "993", Fetch: fetchTLSConnectionState},
+	"ldaps": {DefaultPort: "636", Fetch: fetchTLSConnectionState},
+	"pop3s": {DefaultPort: "995", Fetch: fetchTLSConnectionState},
+	"smtps": {DefaultPort: "465", Fetch: fetchTLSConnectionState},
+	"tls":   {Fetch: fetchTLSConnectionState},
+
+	// Database protocols negotiating TLS inside their wire protocol
+	"mysql":      {DefaultPort: "3306", Fetch: fetchMySQLConnectionState},
+	"postgres":   {DefaultPort: "5432", Fetch: fetchPostgresConnectionState},
+	"postgresql": {DefaultPort: "5432", Fetch: fetchPostgresConnectionState},
+
+	// Protocols using a plaintext greeting and a STARTTLS upgrade
+	"imap":        {DefaultPort: "143", Fetch: fetchIMAPConnectionState},
+	"ldap":        {DefaultPort: "389", Fetch: fetchLDAPConnectionState},
+	"pop3":        {DefaultPort: "110", Fetch: fetchPOP3ConnectionState},
+	"sieve":       {DefaultPort: "4190", Fetch: fetchSieveConnectionState},
+	"smtp":        {DefaultPort: "25", Fetch: fetchSMTPConnectionState},
+	"submission":  {DefaultPort: "587", Fetch: fetchSMTPConnectionState},
+	"xmpp":        {DefaultPort: "5222", Fetch: fetchXMPPClientConnectionState},
+	"xmpp-server": {DefaultPort: "5269", Fetch: fetchXMPPServerConnectionState},
+
+	// Certificates read from storage instead of a connection
+	"file":              {Read: readFileCertificates},
+	"keystore":          {Read: readKeystoreCertificates},
+	"kubernetes-secret": {Read: readKubernetesSecretCertificates},
+}
+
+// offline returns whether the protocol reads the certificates from
+// storage instead of a connection to the host
+func (p probeProtocol) offline() bool { return p.Read != nil }
+
+func protocolForURL(probeURL *url.URL) (probeProtocol, error) {
+	proto, ok := probeProtocols[probeURL.Scheme]
+	if !ok {
+		return probeProtocol{}, fmt.Errorf("Unsupported probe protocol %q", probeURL.Scheme)
+	}
+	return proto, nil
+}
+
+// probeAddress returns the host:port combination to connect to for the
+// given probe URL, using the default port of the protocol if none is set
+func probeAddress(probeURL *url.URL) (string, error) {
+	proto, err := protocolForURL(probeURL)
+	if err != nil {
+		return "", err
+	}
+
+	if proto.offline() {
+		return probeURL.Host, nil
+	}
+
+	port := probeURL.Port()
+	if port == "" {
+		port = proto.DefaultPort
+	}
+
+	if port == "" {
+		return "", fmt.Errorf("Probe URL %q needs to specify a port", probeURL)
+	}
+
+	return net.JoinHostPort(probeURL.Hostname(), port), nil
+}
+
+// resolveProbeAddresses looks up all A / AAAA records of the host in the
+// given address and returns the addresses to connect to in a stable order
+func resolveProbeAddresses(ctx context.Context, addr string) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if net.ParseIP(host) != nil {
+		// No need to resolve an IP address
+		return []string{addr}, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	sort.Strings(addrs)
+
+	return addrs, nil
+}
+
+// fetchCertificates reads the certificates of offline protocols or
+// connects to the address to receive them from the TLS handshake
+func fetchCertificates(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*fetchResult, error) {
+	proto, err := protocolForURL(probeURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if proto.offline() {
+		return proto.Read(ctx, probeURL)
+	}
+
+	state, err := proto.Fetch(ctx, d, probeURL, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fetchResult{
+		Certificates:                state.PeerCertificates,
+		OCSPResponse:                state.OCSPResponse,
+		SignedCertificateTimestamps: state.SignedCertificateTimestamps,
+	}, nil
+}
+
+func fetchHTTPSConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error) {
+	req, _ := http.NewRequest("HEAD", probeURL.String(), nil)
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", fmt.Sprintf("Mozilla/5.0 (compatible; PromCertcheck/%s; +https://github.com/Luzifer/promcertcheck)", version))
+
+	// Configuration to receive redirects and TLS errors while always
+	// connecting to the given address instead of resolving the host
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return redirectFoundError
+		},
+		Transport: &http.Transport{
+			DialTLSContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				conn, err := d.dial(ctx, addr)
+				if err != nil {
+					return nil, err
+				}
+				return d.tlsHandshake(ctx, conn, probeURL.Hostname())
+			},
+			DisableKeepAlives: true,
+		},
+	}
+
+	resp, err := client.Do(req)
+	switch {
+	case err == nil:
+	case strings.Contains(err.Error(), redirectFoundError.Error()):
+		log.WithFields(log.Fields{"probe_url": probeURL}).WithError(err).Warn("A redirect was found")
+	default:
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.TLS == nil {
+		return nil, fmt.Errorf("Connection to %q was not TLS secured", probeURL.Host)
+	}
+
+	return resp.TLS, nil
+}
+
+// probeTLSConfig returns the TLS configuration used for all handshakes.
+// Certificate verification is skipped here as it is done by
+// checkCertificate afterwards.
+func probeTLSConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         serverName,
+	}
+}
+
+func fetchTLSConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error) {
+	conn, err := d.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return d.tlsClient(ctx, conn, probeURL.Hostname())
+}
+
+// handshakeError marks errors occurring during the TLS handshake in
+// order to distinguish them from connection errors
+type handshakeError struct {
+	err error
+}
+
+func (h handshakeError) Error() string { return fmt.Sprintf("TLS handshake failed: %s", h.err) }
+func (h handshakeError) Unwrap() error { return h.err }
+
+// dialer opens connections and executes TLS handshakes within the
+// timeouts configured for the probe
+type dialer struct {
+	timeouts probeTimeouts
+}
+
+// dial opens a plaintext TCP connection to the given address. The
+// deadline of the context is applied to the connection so the whole
+// protocol exchange is limited by the probe timeout.
+func (d dialer) dial(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := (&net.Dialer{Timeout: d.timeouts.Connect}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	return conn, nil
+}
+
+// handshakeDeadline returns the deadline for a handshake started now
+// which is the handshake timeout unless the context expires earlier
+func (d dialer) handshakeDeadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(d.timeouts.Handshake)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	return deadline
+}
+
+// tlsClient wraps an established plaintext connection into a TLS
+// client connection, executes the handshake and returns its state
+func (d dialer) tlsClient(ctx context.Context, conn net.Conn, serverName string) (*tls.ConnectionState, error) {
+	tlsConn, err := d.tlsHandshake(ctx, conn, serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	state := tlsConn.ConnectionState()
+	return &state, nil
+}
+
+// tlsHandshake wraps an established plaintext connection into a TLS
+// client connection and executes the handshake
+func (d dialer) tlsHandshake(ctx context.Context, conn net.Conn, serverName string) (*tls.Conn, error) {
+	conn.SetDeadline(d.handshakeDeadline(ctx))
+
+	tlsConn := tls.Client(conn, probeTLSConfig(serverName))
+	if err := tlsConn.Handshake(); err != nil {
+		// Callers like the HTTP transport only get the error and can't
+		// close the connection themselves
+		conn.Close()
+		return nil, handshakeError{err}
+	}
+
+	// Restore the probe deadline for the remaining exchange
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	return tlsConn, nil
+}
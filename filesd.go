@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// fileSDConfig describes files in the Prometheus file_sd format to
+// discover probe targets from and the settings to apply to them
+type fileSDConfig struct {
+	// Files contains the paths of the files, the last path element may
+	// contain a glob pattern (targets/*.json)
+	Files []string `yaml:"files"`
+
+	probeModule `yaml:",inline"`
+}
+
+// targetGroup is an entry in a file_sd file
+type targetGroup struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+var (
+	// fileSDTargets contains the last successfully read target groups
+	// per file to keep them when a file can't be read while written
+	fileSDTargets     = map[string][]targetGroup{}
+	fileSDTargetsLock sync.Mutex
+)
+
+func (f fileSDConfig) validate() error {
+	if len(f.Files) == 0 {
+		return errors.New("No files given")
+	}
+
+	for _, pattern := range f.Files {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid file pattern %q: %s", pattern, err)
+		}
+	}
+
+	return f.probeModule.validateDiscovery()
+}
+
+// fileSDDefinitions reads the targets from the files of the given
+// configs and returns a probe definition for each of them
+func fileSDDefinitions(configs []fileSDConfig) ([]probeDefinition, error) {
+	fileSDTargetsLock.Lock()
+	defer fileSDTargetsLock.Unlock()
+
+	var (
+		defs []probeDefinition
+		seen = map[string]bool{}
+	)
+
+	for _, sd := range configs {
+		var files []string
+		for _, pattern := range sd.Files {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid file pattern %q: %s", pattern, err)
+			}
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			groups, err := readTargetGroups(file)
+			if err != nil {
+				log.WithFields(log.Fields{"file": file}).WithError(err).Error("Unable to read file_sd file, keeping previous targets")
+				groups = fileSDTargets[file]
+			} else {
+				fileSDTargets[file] = groups
+			}
+			seen[file] = true
+
+			for _, group := range groups {
+				for _, target := range group.Targets {
+					defs = append(defs, sd.discoveredDefinition(target, group.Labels))
+				}
+			}
+		}
+	}
+
+	for file := range fileSDTargets {
+		if !seen[file] {
+			// File was removed, its targets are gone
+			delete(fileSDTargets, file)
+		}
+	}
+
+	return defs, nil
+}
+
+// readTargetGroups reads a file in the file_sd format, JSON files are
+// read using the YAML parser as JSON is a subset of YAML
+func readTargetGroups(filename string) ([]targetGroup, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		decoder = yaml.NewDecoder(f)
+		groups  []targetGroup
+	)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&groups); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Unable to parse file: %s", err)
+	}
+
+	return groups, nil
+}
@@ -1,12 +1,31 @@
 module github.com/Luzifer/promcertcheck
 
-go 1.15
+go 1.21
 
 require (
 	github.com/Luzifer/go_helpers/v2 v2.12.1
 	github.com/Luzifer/rconfig/v2 v2.2.1
 	github.com/flosch/pongo2 v0.0.0-20200913210552-0d938eb266f3
+	github.com/fsnotify/fsnotify v1.4.9
+	github.com/pavlo-v-chernykh/keystore-go/v4 v4.5.0
 	github.com/prometheus/client_golang v1.9.0
-	github.com/robfig/cron v1.2.0
 	github.com/sirupsen/logrus v1.8.0
+	golang.org/x/crypto v0.11.0
+	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.4.0
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.1 // indirect
+	github.com/golang/protobuf v1.4.3 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/client_model v0.2.0 // indirect
+	github.com/prometheus/common v0.15.0 // indirect
+	github.com/prometheus/procfs v0.2.0 // indirect
+	github.com/spf13/pflag v1.0.3 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+	google.golang.org/protobuf v1.25.0 // indirect
+	gopkg.in/validator.v2 v2.0.0-20180514200540-135c24b11c19 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
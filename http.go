@@ -19,7 +19,7 @@ func htmlHandler(res http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := template.ExecuteWriter(pongo2.Context{
-		"results":                probeMonitors,
+		"results":                probeMonitors.Snapshot(),
 		"certificateOK":          certificateOK,
 		"certificateExpiresSoon": certificateExpiresSoon,
 		"version":                version,
@@ -30,8 +30,8 @@ func htmlHandler(res http.ResponseWriter, r *http.Request) {
 
 func httpStatusHandler(res http.ResponseWriter, r *http.Request) {
 	httpStatus := http.StatusOK
-	for _, mon := range probeMonitors {
-		if mon.Status != certificateOK {
+	for _, state := range probeMonitors.Snapshot() {
+		if !state.LastCheck.IsZero() && state.Status.critical() {
 			httpStatus = http.StatusInternalServerError
 		}
 	}
@@ -41,5 +41,5 @@ func httpStatusHandler(res http.ResponseWriter, r *http.Request) {
 
 func jsonHandler(res http.ResponseWriter, r *http.Request) {
 	res.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(res).Encode(probeMonitors)
+	json.NewEncoder(res).Encode(probeMonitors.Snapshot())
 }
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	log "github.com/sirupsen/logrus"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const (
+	keystoreTypeJKS    = "jks"
+	keystoreTypePKCS12 = "pkcs12"
+
+	keystoreEntryPrivateKey = "private_key"
+	keystoreEntryTrusted    = "trusted_certificate"
+
+	// jksMagic is the first four bytes of every Java keystore
+	jksMagic = 0xfeedfeed
+)
+
+// keystoreFileExtensions are the extensions of files read when scanning
+// directories for keystores
+var keystoreFileExtensions = []string{".jks", ".keystore", ".p12", ".pfx", ".truststore"}
+
+// keystoreConfig describes keystores to discover probes from: Every
+// entry of the keystores matching the paths is checked
+type keystoreConfig struct {
+	// Password to open the keystores with
+	Password string `yaml:"password"`
+	// PasswordFile contains the password to open the keystores with
+	PasswordFile string `yaml:"password_file"`
+	// Paths contains files, directories (scanned recursively for files
+	// with the keystoreFileExtensions) or glob patterns of those
+	Paths []string `yaml:"paths"`
+	// RefreshInterval defines how often to scan the paths for keystores
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// Type of the keystores (jks, pkcs12), detected from the content of
+	// the file if not set
+	Type string `yaml:"type"`
+
+	probeModule `yaml:",inline"`
+}
+
+// keystoreEntry is a private key or trusted certificate entry of a
+// keystore with its certificate chain (leaf first)
+type keystoreEntry struct {
+	Alias        string
+	Certificates []*x509.Certificate
+	Type         string
+}
+
+// keystoreDiscoverer scans the paths of the config for keystores
+type keystoreDiscoverer struct {
+	config keystoreConfig
+}
+
+var (
+	// keystoreConfigs contains the config of the discovery source by the
+	// path of the keystores found to read them for keystore probes
+	keystoreConfigs     = map[string]keystoreConfig{}
+	keystoreConfigsLock sync.RWMutex
+)
+
+func (k keystoreConfig) validate() error {
+	if len(k.Paths) == 0 {
+		return errors.New("No paths given")
+	}
+
+	for _, pattern := range k.Paths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid path pattern %q: %s", pattern, err)
+		}
+	}
+
+	if k.Type != "" && k.Type != keystoreTypeJKS && k.Type != keystoreTypePKCS12 {
+		return fmt.Errorf("Unknown keystore type %q", k.Type)
+	}
+
+	if k.Password != "" && k.PasswordFile != "" {
+		return errors.New("Only one of password and password_file can be set")
+	}
+
+	if k.RefreshInterval < 0 {
+		return fmt.Errorf("Invalid refresh_interval %q: must be positive", k.RefreshInterval)
+	}
+
+	return k.probeModule.validateDiscovery()
+}
+
+func (k keystoreConfig) refreshInterval() time.Duration { return k.RefreshInterval }
+
+func (k keystoreConfig) discoverer() (discoverer, error) {
+	return keystoreDiscoverer{config: k}, nil
+}
+
+// password returns the password to open the keystores with
+func (k keystoreConfig) password() (string, error) {
+	if k.PasswordFile == "" {
+		return k.Password, nil
+	}
+
+	password, err := ioutil.ReadFile(k.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read password file: %s", err)
+	}
+
+	return strings.TrimRight(string(password), "\r\n"), nil
+}
+
+func (k keystoreDiscoverer) discover(ctx context.Context) ([]probeDefinition, error) {
+	var files []string
+
+	for _, pattern := range k.config.Paths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid path pattern %q: %s", pattern, err)
+		}
+
+		for _, match := range matches {
+			found, err := findFilesWithExtension(match, keystoreFileExtensions)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, found...)
+		}
+	}
+
+	sort.Strings(files)
+
+	var (
+		defs []probeDefinition
+		seen = map[string]bool{}
+	)
+
+	for _, file := range files {
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+
+		keystoreConfigsLock.Lock()
+		keystoreConfigs[file] = k.config
+		keystoreConfigsLock.Unlock()
+
+		entries, err := readKeystoreFile(file, k.config)
+		if err != nil {
+			// Report the keystore as a whole to make the error visible
+			log.WithFields(log.Fields{"file": file}).WithError(err).Error("Unable to read keystore")
+			defs = append(defs, k.config.discoveredDefinition(keystoreURL(file, ""), nil))
+			continue
+		}
+
+		for _, entry := range entries {
+			defs = append(defs, k.config.discoveredDefinition(keystoreURL(file, entry.Alias), map[string]string{
+				"keystore_alias": entry.Alias,
+				"keystore_entry": entry.Type,
+			}))
+		}
+	}
+
+	return defs, nil
+}
+
+// keystoreURL returns the probe URL for the entry of the keystore
+func keystoreURL(file, alias string) string {
+	u := &url.URL{Scheme: "keystore", Path: filepath.ToSlash(file)}
+	if alias != "" {
+		u.RawQuery = url.Values{"alias": {alias}}.Encode()
+	}
+	return u.String()
+}
+
+// readKeystoreFile reads all entries from the keystore using the type
+// and password of the config
+func readKeystoreFile(file string, config keystoreConfig) ([]keystoreEntry, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := config.password()
+	if err != nil {
+		return nil, err
+	}
+
+	storeType := config.Type
+	if storeType == "" {
+		storeType = keystoreTypePKCS12
+		if len(data) >= 4 && binary.BigEndian.Uint32(data) == jksMagic {
+			storeType = keystoreTypeJKS
+		}
+	}
+
+	var entries []keystoreEntry
+	switch storeType {
+	case keystoreTypeJKS:
+		entries, err = readJKSEntries(data, password)
+	default:
+		entries, err = readPKCS12Entries(data, password)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %s keystore: %s", storeType, err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Alias < entries[j].Alias })
+
+	return entries, nil
+}
+
+func readJKSEntries(data []byte, password string) ([]keystoreEntry, error) {
+	ks := keystore.New(keystore.WithCaseExactAliases())
+	if err := ks.Load(bytes.NewReader(data), []byte(password)); err != nil {
+		return nil, err
+	}
+
+	var entries []keystoreEntry
+	for _, alias := range ks.Aliases() {
+		var (
+			chain     []keystore.Certificate
+			entryType string
+		)
+
+		switch {
+		case ks.IsPrivateKeyEntry(alias):
+			var err error
+			if chain, err = ks.GetPrivateKeyEntryCertificateChain(alias); err != nil {
+				return nil, fmt.Errorf("Unable to read entry %q: %s", alias, err)
+			}
+			entryType = keystoreEntryPrivateKey
+
+		case ks.IsTrustedCertificateEntry(alias):
+			entry, err := ks.GetTrustedCertificateEntry(alias)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read entry %q: %s", alias, err)
+			}
+			chain = []keystore.Certificate{entry.Certificate}
+			entryType = keystoreEntryTrusted
+
+		default:
+			// Secret keys do not contain certificates
+			continue
+		}
+
+		var certs []*x509.Certificate
+		for _, c := range chain {
+			cert, err := x509.ParseCertificate(c.Content)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse certificate of entry %q: %s", alias, err)
+			}
+			certs = append(certs, cert)
+		}
+
+		entries = append(entries, keystoreEntry{Alias: alias, Certificates: certs, Type: entryType})
+	}
+
+	return entries, nil
+}
+
+// pkcs12Bag is a certificate or private key bag of a PKCS#12 file with
+// the attributes used to tell the entries apart
+type pkcs12Bag struct {
+	cert         *x509.Certificate
+	friendlyName string
+	localKeyID   string
+}
+
+// readPKCS12Entries reads one entry per private key (with the chain of
+// its certificate) and per trusted certificate from a PKCS#12 file. The
+// aliases are taken from the friendly names if available, otherwise the
+// entries are numbered.
+func readPKCS12Entries(data []byte, password string) ([]keystoreEntry, error) {
+	certs, keys, err := readPKCS12Bags(data, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		entries []keystoreEntry
+		isLeaf  = map[*x509.Certificate]bool{}
+		inChain = map[*x509.Certificate]bool{}
+	)
+
+	alias := func(names ...string) string {
+		for _, name := range names {
+			if name != "" {
+				return name
+			}
+		}
+		return strconv.Itoa(len(entries) + 1)
+	}
+
+	for _, key := range keys {
+		for _, leaf := range certs {
+			if key.localKeyID == "" || leaf.localKeyID != key.localKeyID {
+				continue
+			}
+
+			chain := pkcs12Chain(leaf.cert, certs)
+			for _, cert := range chain[1:] {
+				inChain[cert] = true
+			}
+			isLeaf[leaf.cert] = true
+
+			entries = append(entries, keystoreEntry{
+				Alias:        alias(key.friendlyName, leaf.friendlyName),
+				Certificates: chain,
+				Type:         keystoreEntryPrivateKey,
+			})
+			break
+		}
+	}
+
+	for _, bag := range certs {
+		if isLeaf[bag.cert] || (inChain[bag.cert] && bag.friendlyName == "") {
+			// Part of a private key entry, trusted certificates are stored
+			// separately with their alias as friendly name
+			continue
+		}
+
+		entries = append(entries, keystoreEntry{
+			Alias:        alias(bag.friendlyName),
+			Certificates: []*x509.Certificate{bag.cert},
+			Type:         keystoreEntryTrusted,
+		})
+	}
+
+	return entries, nil
+}
+
+// readPKCS12Bags returns the certificate and private key bags of the
+// PKCS#12 file. Files which cannot be converted with their attributes
+// (like Java trust stores) are read without attributes, limited to a
+// single private key.
+func readPKCS12Bags(data []byte, password string) (certs, keys []pkcs12Bag, err error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err == nil {
+		for _, block := range blocks {
+			bag := pkcs12Bag{friendlyName: block.Headers["friendlyName"], localKeyID: block.Headers["localKeyId"]}
+
+			switch block.Type {
+			case "CERTIFICATE":
+				if bag.cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+					return nil, nil, fmt.Errorf("Unable to parse certificate: %s", err)
+				}
+				certs = append(certs, bag)
+			case "PRIVATE KEY":
+				keys = append(keys, bag)
+			}
+		}
+		return certs, keys, nil
+	} else if err == pkcs12.ErrIncorrectPassword {
+		return nil, nil, err
+	}
+
+	if _, cert, caCerts, err := pkcs12.DecodeChain(data, password); err == nil {
+		certs = append(certs, pkcs12Bag{cert: cert, localKeyID: "1"})
+		for _, cert := range caCerts {
+			certs = append(certs, pkcs12Bag{cert: cert})
+		}
+		return certs, []pkcs12Bag{{localKeyID: "1"}}, nil
+	}
+
+	trusted, err := pkcs12.DecodeTrustStore(data, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, cert := range trusted {
+		certs = append(certs, pkcs12Bag{cert: cert})
+	}
+	return certs, nil, nil
+}
+
+// pkcs12Chain returns the chain of the leaf (leaf first) built from the
+// certificates of the file
+func pkcs12Chain(leaf *x509.Certificate, bags []pkcs12Bag) []*x509.Certificate {
+	chain := []*x509.Certificate{leaf}
+
+	for cert := leaf; len(chain) <= len(bags); {
+		var issuer *x509.Certificate
+		for _, bag := range bags {
+			if bag.cert != cert && bytes.Equal(bag.cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(bag.cert) == nil {
+				issuer = bag.cert
+				break
+			}
+		}
+
+		if issuer == nil {
+			// Root reached or issuer not contained in the file
+			return chain
+		}
+		chain = append(chain, issuer)
+		cert = issuer
+	}
+
+	return chain
+}
+
+// readKeystoreCertificates reads the certificates of the entry from the
+// keystore given as keystore:///<path>?alias=<alias>. Trusted
+// certificate entries are returned as trust anchors.
+func readKeystoreCertificates(ctx context.Context, probeURL *url.URL) (*fetchResult, error) {
+	file := filepath.FromSlash(probeURL.Path)
+
+	keystoreConfigsLock.RLock()
+	config, ok := keystoreConfigs[file]
+	keystoreConfigsLock.RUnlock()
+
+	if !ok {
+		// Not discovered, try to open the keystore without password
+		config = keystoreConfig{}
+	}
+
+	entries, err := readKeystoreFile(file, config)
+	if err != nil {
+		return nil, err
+	}
+
+	alias := probeURL.Query().Get("alias")
+	if alias == "" && len(entries) == 1 {
+		alias = entries[0].Alias
+	}
+
+	for _, entry := range entries {
+		if entry.Alias != alias {
+			continue
+		}
+
+		return &fetchResult{
+			Certificates: entry.Certificates,
+			TrustAnchor:  entry.Type == keystoreEntryTrusted,
+		}, nil
+	}
+
+	if alias == "" {
+		return nil, errors.New("Keystore contains multiple entries, alias needs to be given")
+	}
+	return nil, fmt.Errorf("Keystore does not contain an entry with alias %q", alias)
+}
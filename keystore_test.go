@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// keystoreEntrySummary describes the entry by its alias, type and the
+// common names of its certificates
+func keystoreEntrySummary(entry keystoreEntry) []string {
+	summary := []string{entry.Alias, entry.Type}
+	for _, cert := range entry.Certificates {
+		summary = append(summary, cert.Subject.CommonName)
+	}
+	return summary
+}
+
+func testReadPKCS12Entries(t *testing.T, data []byte, password string, expected [][]string) {
+	t.Helper()
+
+	entries, err := readPKCS12Entries(data, password)
+	if err != nil {
+		t.Fatalf("Unable to read entries: %s", err)
+	}
+
+	var summaries [][]string
+	for _, entry := range entries {
+		summaries = append(summaries, keystoreEntrySummary(entry))
+	}
+
+	if !reflect.DeepEqual(summaries, expected) {
+		t.Errorf("Expected entries %q, got %q", expected, summaries)
+	}
+}
+
+func TestReadPKCS12EntriesMultiple(t *testing.T) {
+	// Two private key entries (web with an intermediate, mail issued by
+	// the root) and a trusted certificate entry
+	data, err := ioutil.ReadFile("testdata/multiple-entries.p12")
+	if err != nil {
+		t.Fatalf("Unable to read keystore: %s", err)
+	}
+
+	testReadPKCS12Entries(t, data, pkcs12.DefaultPassword, [][]string{
+		{"web", keystoreEntryPrivateKey, "www.example.com", "Test Intermediate CA", "Test Root CA"},
+		{"mail", keystoreEntryPrivateKey, "mail.example.com", "Test Root CA"},
+		{"other-root", keystoreEntryTrusted, "Other Root CA"},
+	})
+
+	if _, err = readPKCS12Entries(data, "wrong"); err != pkcs12.ErrIncorrectPassword {
+		t.Errorf("Expected incorrect password to be reported, got %v", err)
+	}
+}
+
+func TestReadPKCS12EntriesSingleKey(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	leaf := ca.issue(t, 10, &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}})
+
+	data, err := pkcs12.Modern.Encode(leaf.key, leaf.cert, []*x509.Certificate{ca.cert}, pkcs12.DefaultPassword)
+	if err != nil {
+		t.Fatalf("Unable to create keystore: %s", err)
+	}
+
+	testReadPKCS12Entries(t, data, pkcs12.DefaultPassword, [][]string{
+		{"1", keystoreEntryPrivateKey, "leaf", "Test CA"},
+	})
+}
+
+func TestReadPKCS12EntriesTrustStore(t *testing.T) {
+	first, second := newTestCA(t, "First CA"), newTestCA(t, "Second CA")
+
+	// Java trust stores mark the certificates with an attribute the
+	// friendly names cannot be read along with
+	data, err := pkcs12.Modern.EncodeTrustStoreEntries([]pkcs12.TrustStoreEntry{
+		{Cert: first.cert, FriendlyName: "first"},
+		{Cert: second.cert, FriendlyName: "second"},
+	}, pkcs12.DefaultPassword)
+	if err != nil {
+		t.Fatalf("Unable to create trust store: %s", err)
+	}
+
+	testReadPKCS12Entries(t, data, pkcs12.DefaultPassword, [][]string{
+		{"1", keystoreEntryTrusted, "First CA"},
+		{"2", keystoreEntryTrusted, "Second CA"},
+	})
+}
+
+func TestReadKeystoreCertificatesTrustAnchor(t *testing.T) {
+	file, err := filepath.Abs("testdata/multiple-entries.p12")
+	if err != nil {
+		t.Fatalf("Unable to determine keystore path: %s", err)
+	}
+
+	keystoreConfigsLock.Lock()
+	keystoreConfigs[file] = keystoreConfig{Password: pkcs12.DefaultPassword}
+	keystoreConfigsLock.Unlock()
+	t.Cleanup(func() {
+		keystoreConfigsLock.Lock()
+		delete(keystoreConfigs, file)
+		keystoreConfigsLock.Unlock()
+	})
+
+	for alias, trustAnchor := range map[string]bool{"web": false, "other-root": true} {
+		probeURL, _ := url.Parse(keystoreURL(file, alias))
+
+		fetched, err := readKeystoreCertificates(context.Background(), probeURL)
+		if err != nil {
+			t.Fatalf("Unable to read entry %q: %s", alias, err)
+		}
+		if fetched.TrustAnchor != trustAnchor {
+			t.Errorf("Expected entry %q to be reported as trust anchor: %v", alias, trustAnchor)
+		}
+	}
+}
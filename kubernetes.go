@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Luzifer/go_helpers/v2/str"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	kubernetesInClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	kubernetesInClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	kubernetesResourceHTTPRoute = "httproute"
+	kubernetesResourceIngress   = "ingress"
+	kubernetesResourceSecret    = "secret"
+
+	kubernetesListLimit = "500"
+
+	kubernetesAcceptJSON = "application/json"
+	// kubernetesAcceptMetadata requests lists containing only the
+	// metadata of the objects instead of the full objects
+	kubernetesAcceptMetadata = "application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1"
+)
+
+var kubernetesResources = []string{kubernetesResourceHTTPRoute, kubernetesResourceIngress, kubernetesResourceSecret}
+
+// kubernetesConfig describes a Kubernetes API server to discover probes
+// from: The TLS hosts of Ingress objects, the host names of Gateway API
+// HTTPRoutes and the certificates in kubernetes.io/tls Secrets
+type kubernetesConfig struct {
+	// APIServer is the URL of the API server, when empty the in-cluster
+	// configuration of the pod is used
+	APIServer string `yaml:"api_server"`
+	// CAFile contains the certificates to verify the API server with
+	CAFile string `yaml:"ca_file"`
+	// TokenFile contains the bearer token to authenticate with, it is
+	// read on every request to support rotated tokens
+	TokenFile string `yaml:"token_file"`
+
+	// LabelSelector limits the objects to those matching the selector
+	LabelSelector string `yaml:"label_selector"`
+	// Namespaces to discover objects in, all namespaces if empty
+	Namespaces []string `yaml:"namespaces"`
+	// RefreshInterval defines how often to list the objects
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// Resources to discover: ingress, httproute and / or secret
+	Resources []string `yaml:"resources"`
+
+	probeModule `yaml:",inline"`
+}
+
+// kubernetesClient is a minimal client for the read-only requests
+// needed to discover probes
+type kubernetesClient struct {
+	apiServer *url.URL
+	client    *http.Client
+	tokenFile string
+}
+
+// kubernetesObjectMeta contains the fields of the object metadata used
+// to build probes
+type kubernetesObjectMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type kubernetesIngress struct {
+	Metadata kubernetesObjectMeta `json:"metadata"`
+	Spec     struct {
+		TLS []struct {
+			Hosts []string `json:"hosts"`
+		} `json:"tls"`
+	} `json:"spec"`
+}
+
+type kubernetesHTTPRoute struct {
+	Metadata kubernetesObjectMeta `json:"metadata"`
+	Spec     struct {
+		Hostnames []string `json:"hostnames"`
+	} `json:"spec"`
+}
+
+type kubernetesSecret struct {
+	Metadata kubernetesObjectMeta `json:"metadata"`
+	Data     map[string][]byte    `json:"data"`
+	Type     string               `json:"type"`
+}
+
+// kubernetesAPIError is returned for requests not answered with 200 OK
+type kubernetesAPIError struct {
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (k kubernetesAPIError) Error() string {
+	return fmt.Sprintf("Kubernetes API responded with status %d for %q: %s", k.StatusCode, k.Path, k.Message)
+}
+
+// kubernetesDiscoverer lists the configured resources from the API
+type kubernetesDiscoverer struct {
+	client *kubernetesClient
+	config kubernetesConfig
+}
+
+var (
+	// kubernetesClients contains the clients of the configured API
+	// servers by their host to fetch Secrets for kubernetes-secret probes
+	kubernetesClients     = map[string]*kubernetesClient{}
+	kubernetesClientsLock sync.RWMutex
+)
+
+func (k kubernetesConfig) validate() error {
+	for _, resource := range k.Resources {
+		if !str.StringInSlice(resource, kubernetesResources) {
+			return fmt.Errorf("Unknown resource %q", resource)
+		}
+	}
+
+	if k.RefreshInterval < 0 {
+		return fmt.Errorf("Invalid refresh_interval %q: must be positive", k.RefreshInterval)
+	}
+
+	if k.APIServer != "" {
+		if _, err := url.Parse(k.APIServer); err != nil {
+			return fmt.Errorf("Invalid api_server %q: %s", k.APIServer, err)
+		}
+	}
+
+	return k.probeModule.validateDiscovery()
+}
+
+func (k kubernetesConfig) refreshInterval() time.Duration { return k.RefreshInterval }
+
+func (k kubernetesConfig) discoverer() (discoverer, error) {
+	client, err := newKubernetesClient(k)
+	if err != nil {
+		return nil, err
+	}
+
+	kubernetesClientsLock.Lock()
+	kubernetesClients[client.apiServer.Host] = client
+	kubernetesClientsLock.Unlock()
+
+	return kubernetesDiscoverer{client: client, config: k}, nil
+}
+
+func newKubernetesClient(k kubernetesConfig) (*kubernetesClient, error) {
+	apiServer, caFile, tokenFile := k.APIServer, k.CAFile, k.TokenFile
+
+	if apiServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("Not running inside Kubernetes, api_server needs to be set")
+		}
+
+		apiServer = "https://" + net.JoinHostPort(host, port)
+		if caFile == "" {
+			caFile = kubernetesInClusterCAFile
+		}
+		if tokenFile == "" {
+			tokenFile = kubernetesInClusterTokenFile
+		}
+	}
+
+	apiURL, err := url.Parse(apiServer)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid API server URL: %s", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read CA file: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in CA file %q", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &kubernetesClient{
+		apiServer: apiURL,
+		client:    &http.Client{Transport: transport},
+		tokenFile: tokenFile,
+	}, nil
+}
+
+func getKubernetesClient(host string) *kubernetesClient {
+	kubernetesClientsLock.RLock()
+	defer kubernetesClientsLock.RUnlock()
+
+	return kubernetesClients[host]
+}
+
+// get requests the given API path accepting the given media type and
+// decodes the JSON response
+func (k *kubernetesClient) get(ctx context.Context, apiPath string, query url.Values, accept string, v interface{}) error {
+	reqURL := *k.apiServer
+	reqURL.Path = path.Join(reqURL.Path, apiPath)
+	reqURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", accept)
+
+	if k.tokenFile != "" {
+		token, err := ioutil.ReadFile(k.tokenFile)
+		if err != nil {
+			return fmt.Errorf("Unable to read token file: %s", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return kubernetesAPIError{Path: apiPath, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// list requests all pages of the list at the given API path and calls
+// the handler for every item
+func (k *kubernetesClient) list(ctx context.Context, apiPath string, query url.Values, accept string, handle func(json.RawMessage) error) error {
+	query.Set("limit", kubernetesListLimit)
+
+	for {
+		var page struct {
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+			Items []json.RawMessage `json:"items"`
+		}
+
+		if err := k.get(ctx, apiPath, query, accept, &page); err != nil {
+			return err
+		}
+
+		for _, item := range page.Items {
+			if err := handle(item); err != nil {
+				return err
+			}
+		}
+
+		if page.Metadata.Continue == "" {
+			return nil
+		}
+		query.Set("continue", page.Metadata.Continue)
+	}
+}
+
+func (k kubernetesDiscoverer) discover(ctx context.Context) ([]probeDefinition, error) {
+	resources := k.config.Resources
+	if len(resources) == 0 {
+		resources = []string{kubernetesResourceIngress}
+	}
+
+	namespaces := k.config.Namespaces
+	if len(namespaces) == 0 {
+		// Cluster wide
+		namespaces = []string{""}
+	}
+
+	var (
+		defs []probeDefinition
+		seen = map[string]bool{}
+	)
+
+	add := func(target, kind string, meta kubernetesObjectMeta) {
+		if seen[target] {
+			// Same host in multiple objects, keep the first one
+			return
+		}
+		seen[target] = true
+
+		def := k.config.discoveredDefinition(target, map[string]string{
+			"kubernetes_kind":      kind,
+			"kubernetes_name":      meta.Name,
+			"kubernetes_namespace": meta.Namespace,
+		})
+		if kind == "Secret" {
+			// Secrets are always read from the API
+			def.Protocol = ""
+		}
+		defs = append(defs, def)
+	}
+
+	for _, namespace := range namespaces {
+		for _, resource := range resources {
+			query := url.Values{}
+			if k.config.LabelSelector != "" {
+				query.Set("labelSelector", k.config.LabelSelector)
+			}
+
+			var err error
+			switch resource {
+			case kubernetesResourceIngress:
+				err = k.client.list(ctx, kubernetesListPath("/apis/networking.k8s.io/v1", namespace, "ingresses"), query, kubernetesAcceptJSON, func(item json.RawMessage) error {
+					var ingress kubernetesIngress
+					if err := json.Unmarshal(item, &ingress); err != nil {
+						return err
+					}
+
+					for _, tls := range ingress.Spec.TLS {
+						for _, host := range tls.Hosts {
+							if !strings.Contains(host, "*") {
+								add(host, "Ingress", ingress.Metadata)
+							}
+						}
+					}
+					return nil
+				})
+
+			case kubernetesResourceHTTPRoute:
+				err = k.client.list(ctx, kubernetesListPath("/apis/gateway.networking.k8s.io/v1", namespace, "httproutes"), query, kubernetesAcceptJSON, func(item json.RawMessage) error {
+					var route kubernetesHTTPRoute
+					if err := json.Unmarshal(item, &route); err != nil {
+						return err
+					}
+
+					for _, host := range route.Spec.Hostnames {
+						if !strings.Contains(host, "*") {
+							add(host, "HTTPRoute", route.Metadata)
+						}
+					}
+					return nil
+				})
+
+			case kubernetesResourceSecret:
+				query.Set("fieldSelector", "type=kubernetes.io/tls")
+				// Only the names are needed, the certificates are read when
+				// checking the probe and the private keys never
+				err = k.client.list(ctx, kubernetesListPath("/api/v1", namespace, "secrets"), query, kubernetesAcceptMetadata, func(item json.RawMessage) error {
+					var secret struct {
+						Metadata kubernetesObjectMeta `json:"metadata"`
+					}
+					if err := json.Unmarshal(item, &secret); err != nil {
+						return err
+					}
+
+					add(kubernetesSecretURL(k.client.apiServer.Host, secret.Metadata), "Secret", secret.Metadata)
+					return nil
+				})
+			}
+
+			var apiErr kubernetesAPIError
+			switch {
+			case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+				// Resource is not available in the cluster (Gateway API not installed)
+				log.WithFields(log.Fields{"resource": resource}).WithError(err).Warn("Resource not available in Kubernetes API")
+			case err != nil:
+				return nil, fmt.Errorf("Unable to list %s objects: %s", resource, err)
+			}
+		}
+	}
+
+	sort.Slice(defs, func(i, j int) bool { return defs[i].probeURL() < defs[j].probeURL() })
+
+	return defs, nil
+}
+
+func kubernetesListPath(prefix, namespace, resource string) string {
+	if namespace == "" {
+		return path.Join(prefix, resource)
+	}
+	return path.Join(prefix, "namespaces", namespace, resource)
+}
+
+// kubernetesSecretURL returns the probe URL for a Secret: The host is
+// the API server to read the Secret from
+func kubernetesSecretURL(apiHost string, meta kubernetesObjectMeta) string {
+	return (&url.URL{
+		Scheme: "kubernetes-secret",
+		Host:   apiHost,
+		Path:   path.Join("/", meta.Namespace, meta.Name),
+	}).String()
+}
+
+// readKubernetesSecretCertificates reads the certificates from the
+// kubernetes.io/tls Secret given as kubernetes-secret://<api server>/<namespace>/<name>
+func readKubernetesSecretCertificates(ctx context.Context, probeURL *url.URL) (*fetchResult, error) {
+	client := getKubernetesClient(probeURL.Host)
+	if client == nil {
+		return nil, fmt.Errorf("No Kubernetes discovery configured for API server %q", probeURL.Host)
+	}
+
+	parts := strings.Split(strings.Trim(probeURL.Path, "/"), "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Secret needs to be given as /<namespace>/<name>, got %q", probeURL.Path)
+	}
+
+	var secret kubernetesSecret
+	if err := client.get(ctx, path.Join("/api/v1/namespaces", parts[0], "secrets", parts[1]), url.Values{}, kubernetesAcceptJSON, &secret); err != nil {
+		return nil, err
+	}
+
+	certs, err := parseCertificates(secret.Data["tls.crt"])
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read tls.crt from Secret: %s", err)
+	}
+
+	return &fetchResult{Certificates: certs}, nil
+}
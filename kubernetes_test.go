@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// newTestKubernetesAPI starts a stand-in API server answering the paths
+// using the given handlers and everything else with 404 Not Found
+func newTestKubernetesAPI(t *testing.T, handlers map[string]http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.URL.Path]
+		if !ok {
+			http.Error(w, `{"kind":"Status","reason":"NotFound"}`, http.StatusNotFound)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// writeKubernetesList responds with a list of the given items and the
+// continue token to fetch the next page with
+func writeKubernetesList(t *testing.T, w http.ResponseWriter, cont string, items ...interface{}) {
+	t.Helper()
+
+	list := map[string]interface{}{
+		"metadata": map[string]string{"continue": cont},
+		"items":    items,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		t.Errorf("Unable to encode list: %s", err)
+	}
+}
+
+func kubernetesTestObject(namespace, name string, fields map[string]interface{}) map[string]interface{} {
+	obj := map[string]interface{}{
+		"metadata": map[string]string{"name": name, "namespace": namespace},
+	}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	return obj
+}
+
+// discoverKubernetesTest runs the discovery of the given config against
+// the stand-in API server and returns the discovered probe URLs
+func discoverKubernetesTest(t *testing.T, srv *httptest.Server, config kubernetesConfig) ([]probeDefinition, []string) {
+	t.Helper()
+
+	config.APIServer = srv.URL
+	d, err := config.discoverer()
+	if err != nil {
+		t.Fatalf("Unable to create discoverer: %s", err)
+	}
+	t.Cleanup(func() {
+		kubernetesClientsLock.Lock()
+		delete(kubernetesClients, d.(kubernetesDiscoverer).client.apiServer.Host)
+		kubernetesClientsLock.Unlock()
+	})
+
+	defs, err := d.discover(context.Background())
+	if err != nil {
+		t.Fatalf("Unable to discover probes: %s", err)
+	}
+
+	var urls []string
+	for _, def := range defs {
+		urls = append(urls, def.probeURL())
+	}
+	return defs, urls
+}
+
+func TestKubernetesDiscoverIngress(t *testing.T) {
+	var pages []string
+
+	srv := newTestKubernetesAPI(t, map[string]http.HandlerFunc{
+		"/apis/networking.k8s.io/v1/namespaces/web/ingresses": func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			if q.Get("limit") != kubernetesListLimit || q.Get("labelSelector") != "team=web" {
+				t.Errorf("Unexpected list query %q", r.URL.RawQuery)
+			}
+			if accept := r.Header.Get("Accept"); accept != kubernetesAcceptJSON {
+				t.Errorf("Unexpected Accept header %q", accept)
+			}
+			pages = append(pages, q.Get("continue"))
+
+			switch q.Get("continue") {
+			case "":
+				writeKubernetesList(t, w, "page-2", kubernetesTestObject("web", "shop", map[string]interface{}{
+					"spec": map[string]interface{}{"tls": []interface{}{
+						map[string]interface{}{"hosts": []string{"shop.example.com", "*.example.com"}},
+					}},
+				}))
+			case "page-2":
+				writeKubernetesList(t, w, "", kubernetesTestObject("web", "www", map[string]interface{}{
+					"spec": map[string]interface{}{"tls": []interface{}{
+						map[string]interface{}{"hosts": []string{"www.example.com", "shop.example.com"}},
+					}},
+				}))
+			default:
+				t.Errorf("Unexpected continue token %q", q.Get("continue"))
+			}
+		},
+	})
+
+	defs, urls := discoverKubernetesTest(t, srv, kubernetesConfig{
+		LabelSelector: "team=web",
+		Namespaces:    []string{"web"},
+	})
+
+	if expected := []string{"", "page-2"}; !reflect.DeepEqual(pages, expected) {
+		t.Errorf("Expected pages %q to be requested, got %q", expected, pages)
+	}
+	if expected := []string{"https://shop.example.com", "https://www.example.com"}; !reflect.DeepEqual(urls, expected) {
+		t.Fatalf("Expected probes %q, got %q", expected, urls)
+	}
+
+	expectedLabels := map[string]string{
+		"kubernetes_kind":      "Ingress",
+		"kubernetes_name":      "shop",
+		"kubernetes_namespace": "web",
+	}
+	if !reflect.DeepEqual(defs[0].Labels, expectedLabels) {
+		t.Errorf("Expected labels %v, got %v", expectedLabels, defs[0].Labels)
+	}
+}
+
+func TestKubernetesDiscoverHTTPRoute(t *testing.T) {
+	srv := newTestKubernetesAPI(t, map[string]http.HandlerFunc{
+		"/apis/gateway.networking.k8s.io/v1/httproutes": func(w http.ResponseWriter, r *http.Request) {
+			writeKubernetesList(t, w, "", kubernetesTestObject("api", "backend", map[string]interface{}{
+				"spec": map[string]interface{}{"hostnames": []string{"api.example.com", "*.api.example.com"}},
+			}))
+		},
+	})
+
+	defs, urls := discoverKubernetesTest(t, srv, kubernetesConfig{Resources: []string{kubernetesResourceHTTPRoute}})
+
+	if expected := []string{"https://api.example.com"}; !reflect.DeepEqual(urls, expected) {
+		t.Fatalf("Expected probes %q, got %q", expected, urls)
+	}
+	if kind := defs[0].Labels["kubernetes_kind"]; kind != "HTTPRoute" {
+		t.Errorf("Expected kind HTTPRoute, got %q", kind)
+	}
+}
+
+func TestKubernetesDiscoverWithoutGatewayAPI(t *testing.T) {
+	srv := newTestKubernetesAPI(t, map[string]http.HandlerFunc{
+		"/apis/networking.k8s.io/v1/ingresses": func(w http.ResponseWriter, r *http.Request) {
+			writeKubernetesList(t, w, "", kubernetesTestObject("web", "www", map[string]interface{}{
+				"spec": map[string]interface{}{"tls": []interface{}{
+					map[string]interface{}{"hosts": []string{"www.example.com"}},
+				}},
+			}))
+		},
+	})
+
+	_, urls := discoverKubernetesTest(t, srv, kubernetesConfig{
+		Resources: []string{kubernetesResourceHTTPRoute, kubernetesResourceIngress},
+	})
+
+	if expected := []string{"https://www.example.com"}; !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Expected probes %q, got %q", expected, urls)
+	}
+}
+
+func TestKubernetesDiscoverSecret(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	leaf := ca.issue(t, 10, &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}).cert
+
+	srv := newTestKubernetesAPI(t, map[string]http.HandlerFunc{
+		"/api/v1/secrets": func(w http.ResponseWriter, r *http.Request) {
+			if accept := r.Header.Get("Accept"); accept != kubernetesAcceptMetadata {
+				t.Errorf("Expected Secrets to be listed as metadata only, got Accept header %q", accept)
+			}
+			if selector := r.URL.Query().Get("fieldSelector"); selector != "type=kubernetes.io/tls" {
+				t.Errorf("Unexpected field selector %q", selector)
+			}
+			writeKubernetesList(t, w, "", kubernetesTestObject("web", "www-tls", nil))
+		},
+		"/api/v1/namespaces/web/secrets/www-tls": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(kubernetesTestObject("web", "www-tls", map[string]interface{}{
+				"type": "kubernetes.io/tls",
+				"data": map[string][]byte{
+					"tls.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}),
+				},
+			}))
+		},
+	})
+
+	_, urls := discoverKubernetesTest(t, srv, kubernetesConfig{Resources: []string{kubernetesResourceSecret}})
+
+	apiHost := srv.Listener.Addr().String()
+	if expected := []string{"kubernetes-secret://" + apiHost + "/web/www-tls"}; !reflect.DeepEqual(urls, expected) {
+		t.Fatalf("Expected probes %q, got %q", expected, urls)
+	}
+
+	probeURL, _ := url.Parse(urls[0])
+	fetched, err := readKubernetesSecretCertificates(context.Background(), probeURL)
+	if err != nil {
+		t.Fatalf("Unable to read Secret: %s", err)
+	}
+	if len(fetched.Certificates) != 1 || !fetched.Certificates[0].Equal(leaf) {
+		t.Errorf("Expected certificate of the Secret to be returned")
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
@@ -13,24 +12,41 @@ import (
 	"time"
 
 	"github.com/Luzifer/rconfig/v2"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/robfig/cron"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
 	cfg struct {
-		Listen         string        `flag:"listen" default:":3000" description:"Port/IP to listen on"`
-		ExpireWarning  time.Duration `flag:"expire-warning" default:"744h" description:"When to warn about a soon expiring certificate"`
-		RootsDir       string        `flag:"roots-dir" default:"" description:"Directory to load custom RootCA certs from to be trusted (*.pem)"`
-		LogLevel       string        `flag:"log-level" default:"info" description:"Verbosity of logs to use (debug, info, warning, error, ...)"`
-		Probes         []string      `flag:"probe" default:"" description:"URLs to check for certificate issues"`
-		VersionAndExit bool          `flag:"version" default:"false" description:"Print program version and exit"`
+		CheckInterval    time.Duration `flag:"check-interval" default:"1h" description:"How often to check the probes (can be overridden per probe)"`
+		CheckJitter      time.Duration `flag:"check-jitter" default:"1m" description:"Maximum random delay before the first check of a probe to spread the load"`
+		Concurrency      int           `flag:"concurrency" default:"10" description:"Maximum number of probes to check in parallel"`
+		Config           string        `flag:"config" default:"" description:"YAML/JSON file to load probe definitions from"`
+		ConnectTimeout   time.Duration `flag:"connect-timeout" default:"10s" description:"Timeout for establishing the connection to the probe"`
+		CRL              bool          `flag:"crl" default:"false" description:"Check the revocation status of the certificates in the chain using the CRLs of their issuers"`
+		CRLCacheDir      string        `flag:"crl-cache-dir" default:"" description:"Directory to cache downloaded CRLs in (defaults to a directory in the system temp dir)"`
+		CT               bool          `flag:"ct" default:"false" description:"Verify the Signed Certificate Timestamps of the certificates against the CT log list and policy"`
+		CTLogList        string        `flag:"ct-log-list" default:"" description:"CT log list (v3 JSON format) to verify Signed Certificate Timestamps against"`
+		CTMinOperators   int           `flag:"ct-min-operators" default:"2" description:"Minimum number of distinct log operators having issued valid SCTs for a certificate"`
+		CTMinSCTs        int           `flag:"ct-min-scts" default:"2" description:"Minimum number of valid SCTs from distinct logs for a certificate"`
+		Listen           string        `flag:"listen" default:":3000" description:"Port/IP to listen on"`
+		ExpireCritical   time.Duration `flag:"expire-critical" default:"168h" description:"When to consider a soon expiring certificate critical"`
+		ExpireWarning    time.Duration `flag:"expire-warning" default:"744h" description:"When to warn about a soon expiring certificate"`
+		FileSD           []string      `flag:"file-sd" default:"" description:"Prometheus file_sd compatible files to discover probe targets from (globs allowed)"`
+		HandshakeTimeout time.Duration `flag:"handshake-timeout" default:"10s" description:"Timeout for the TLS handshake with the probe"`
+		RootsDir         string        `flag:"roots-dir" default:"" description:"Directory to load custom RootCA certs from to be trusted (*.pem)"`
+		LogLevel         string        `flag:"log-level" default:"info" description:"Verbosity of logs to use (debug, info, warning, error, ...)"`
+		OCSP             bool          `flag:"ocsp" default:"false" description:"Check the revocation status of the certificates using stapled OCSP responses or the OCSP responder"`
+		Probes           []string      `flag:"probe" default:"" description:"URLs to check for certificate issues"`
+		ProbeTimeout     time.Duration `flag:"probe-timeout" default:"30s" description:"Timeout for the whole check of a probe including protocol exchange (of all addresses together with --resolve-all)"`
+		ResolveAll       bool          `flag:"resolve-all" default:"false" description:"Resolve all A/AAAA records of the probe hosts and check every address"`
+		VersionAndExit   bool          `flag:"version" default:"false" description:"Print program version and exit"`
 	}
 
 	version = "dev"
 
-	probeMonitors = map[string]*probe{}
+	probeMonitors = newProbeStore()
 	rootPool      *x509.CertPool
 
 	redirectFoundError = errors.New("Found a redirect")
@@ -52,17 +68,33 @@ func init() {
 	} else {
 		log.Fatalf("Unable to parse log level: %s", err)
 	}
-}
 
-func main() {
-	// Configuration to receive redirects and TLS errors
-	http.DefaultClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-		return redirectFoundError
+	if cfg.Concurrency < 1 {
+		log.Fatal("Concurrency must be at least 1")
+	}
+
+	if cfg.ExpireCritical > cfg.ExpireWarning {
+		log.Fatal("Expire critical must not exceed expire warning")
+	}
+
+	if cfg.CTMinOperators < 1 || cfg.CTMinSCTs < 1 {
+		log.Fatal("CT minimum SCTs and operators must be at least 1")
+	}
+
+	if cfg.CT && cfg.CTLogList == "" {
+		log.Fatal("CT verification requires a CT log list")
 	}
-	http.DefaultClient.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+
+	if cfg.CheckInterval <= 0 {
+		log.Fatal("Check interval must be positive")
+	}
+
+	if cfg.ConnectTimeout <= 0 || cfg.HandshakeTimeout <= 0 || cfg.ProbeTimeout <= 0 {
+		log.Fatal("Timeouts must be positive")
 	}
+}
 
+func main() {
 	// Load valid CAs from system and specified folder
 	var err error
 	if rootPool, err = x509.SystemCertPool(); err != nil {
@@ -73,20 +105,33 @@ func main() {
 		log.WithError(err).Fatal("Could not load intermediate certificates")
 	}
 
-	registerProbes()
-	refreshCertificateStatus()
+	if cfg.CTLogList != "" {
+		if ctLogs, err = loadCTLogList(cfg.CTLogList); err != nil {
+			log.WithError(err).Fatal("Unable to load CT log list")
+		}
+	}
+
+	if err = startFileWatcher(); err != nil {
+		log.WithError(err).Fatal("Unable to watch config files")
+	}
+
+	startRefreshWorkers(cfg.Concurrency)
+	if err = syncProbes(); err != nil {
+		log.WithError(err).Fatal("Unable to load probes")
+	}
+
+	watchReloadSignal()
 
 	log.WithFields(log.Fields{
 		"version": version,
 	}).Info("PromCertcheck started to listen on 0.0.0.0:3000")
 
-	c := cron.New()
-	c.AddFunc("0 0 * * * *", refreshCertificateStatus)
-	c.Start()
+	prometheus.MustRegister(probeCollector{store: probeMonitors})
 
 	http.Handle("/metrics", promhttp.Handler())
 	http.HandleFunc("/", htmlHandler)
 	http.HandleFunc("/httpStatus", httpStatusHandler)
+	http.HandleFunc("/probe", probeHandler)
 	http.HandleFunc("/results.json", jsonHandler)
 	http.ListenAndServe(cfg.Listen, nil)
 }
@@ -121,35 +166,3 @@ func loadAdditionalRootCAPool(pool *x509.CertPool) error {
 		return nil
 	})
 }
-
-func registerProbes() {
-	for _, probeURL := range cfg.Probes {
-		p, err := probeFromURL(probeURL)
-		if err != nil {
-			log.WithError(err).Error("Unable to create probe")
-			continue
-		}
-
-		probeMonitors[p.url.Host] = p
-		log.WithFields(log.Fields{
-			"host": p.url.Host,
-		}).Info("Probe registered")
-	}
-}
-
-func refreshCertificateStatus() {
-	for _, p := range probeMonitors {
-		go func(p *probe) {
-			logger := log.WithFields(log.Fields{
-				"host": p.url.Host,
-			})
-
-			if err := p.refresh(); err != nil {
-				logger.WithError(err).Error("Unable to refresh probe status")
-				return
-			}
-
-			logger.Debug("Probe refreshed")
-		}(p)
-	}
-}
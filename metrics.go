@@ -0,0 +1,271 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reservedLabelNames are used by the metrics themselves and therefore
+// must not be used as probe labels
+var reservedLabelNames = []string{"address", "host", "reason", "status"}
+
+// probeMetricDescs contains the descriptors of the exported metrics.
+// As probes may carry arbitrary labels, the descriptors are built on
+// every scrape with the union of all label names of the probes.
+type probeMetricDescs struct {
+	labelNames []string
+
+	expires             *prometheus.Desc
+	chainExpires        *prometheus.Desc
+	isValid             *prometheus.Desc
+	addressExpires      *prometheus.Desc
+	addressChainExpires *prometheus.Desc
+	addressIsValid      *prometheus.Desc
+	ocspStatus          *prometheus.Desc
+	ocspStapled         *prometheus.Desc
+	ocspThisUpdate      *prometheus.Desc
+	ocspNextUpdate      *prometheus.Desc
+	crlStatus           *prometheus.Desc
+	crlNextUpdate       *prometheus.Desc
+	ctCompliant         *prometheus.Desc
+	ctValidSCTs         *prometheus.Desc
+	ctOperators         *prometheus.Desc
+}
+
+func newProbeMetricDescs(labelNames []string) probeMetricDescs {
+	withLabels := func(names ...string) []string {
+		return append(names, labelNames...)
+	}
+
+	return probeMetricDescs{
+		labelNames: labelNames,
+
+		expires: prometheus.NewDesc(
+			"certcheck_expires",
+			"Expiration date in unix timestamp (UTC)",
+			withLabels("host"), nil,
+		),
+		chainExpires: prometheus.NewDesc(
+			"certcheck_chain_expires",
+			"Earliest expiration date of all certificates in the verified chains in unix timestamp (UTC)",
+			withLabels("host"), nil,
+		),
+		isValid: prometheus.NewDesc(
+			"certcheck_valid",
+			"Validity of the certificate (0/1), reason contains the probe result",
+			withLabels("host", "reason"), nil,
+		),
+		addressExpires: prometheus.NewDesc(
+			"certcheck_address_expires",
+			"Expiration date in unix timestamp (UTC) per resolved address",
+			withLabels("host", "address"), nil,
+		),
+		addressChainExpires: prometheus.NewDesc(
+			"certcheck_address_chain_expires",
+			"Earliest expiration date of all certificates in the verified chains in unix timestamp (UTC) per resolved address",
+			withLabels("host", "address"), nil,
+		),
+		addressIsValid: prometheus.NewDesc(
+			"certcheck_address_valid",
+			"Validity of the certificate (0/1) per resolved address, reason contains the probe result",
+			withLabels("host", "address", "reason"), nil,
+		),
+		ocspStatus: prometheus.NewDesc(
+			"certcheck_ocsp_status",
+			"OCSP status of the certificate (1 for the current status: good, revoked, unknown, error)",
+			withLabels("host", "status"), nil,
+		),
+		ocspStapled: prometheus.NewDesc(
+			"certcheck_ocsp_stapled",
+			"Whether the server stapled an OCSP response (0/1)",
+			withLabels("host"), nil,
+		),
+		ocspThisUpdate: prometheus.NewDesc(
+			"certcheck_ocsp_this_update",
+			"Time the OCSP response was produced in unix timestamp (UTC)",
+			withLabels("host"), nil,
+		),
+		ocspNextUpdate: prometheus.NewDesc(
+			"certcheck_ocsp_next_update",
+			"Time the OCSP response is valid until in unix timestamp (UTC)",
+			withLabels("host"), nil,
+		),
+		crlStatus: prometheus.NewDesc(
+			"certcheck_crl_status",
+			"Worst CRL status of the certificates in the chain (1 for the current status: good, stale, error, revoked)",
+			withLabels("host", "status"), nil,
+		),
+		crlNextUpdate: prometheus.NewDesc(
+			"certcheck_crl_next_update",
+			"Earliest next update of the CRLs of the chain in unix timestamp (UTC)",
+			withLabels("host"), nil,
+		),
+		ctCompliant: prometheus.NewDesc(
+			"certcheck_ct_compliant",
+			"Whether the SCTs of the certificate comply with the CT policy (0/1)",
+			withLabels("host"), nil,
+		),
+		ctValidSCTs: prometheus.NewDesc(
+			"certcheck_ct_valid_scts",
+			"Number of distinct logs having issued a valid SCT for the certificate",
+			withLabels("host"), nil,
+		),
+		ctOperators: prometheus.NewDesc(
+			"certcheck_ct_operators",
+			"Number of distinct log operators having issued a valid SCT for the certificate",
+			withLabels("host"), nil,
+		),
+	}
+}
+
+// labelValues returns the values of the probe labels in the order of
+// the label names, labels not set on the probe are exported empty
+func (d probeMetricDescs) labelValues(labels map[string]string, values ...string) []string {
+	for _, name := range d.labelNames {
+		values = append(values, labels[name])
+	}
+	return values
+}
+
+// probeCollector exports the results of the probes in the store. As
+// the metrics are generated from a snapshot on every scrape, the values
+// of one probe are always consistent and removed probes vanish.
+type probeCollector struct {
+	store *probeStore
+}
+
+// Describe sends no descriptors as the label names depend on the probes
+// registered at the time of the scrape which makes this an unchecked
+// collector
+func (c probeCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c probeCollector) Collect(ch chan<- prometheus.Metric) {
+	states := c.store.Snapshot()
+
+	var (
+		labelNames []string
+		seen       = map[string]bool{}
+	)
+	for _, state := range states {
+		for name := range state.Labels {
+			if !seen[name] {
+				seen[name] = true
+				labelNames = append(labelNames, name)
+			}
+		}
+	}
+	sort.Strings(labelNames)
+
+	descs := newProbeMetricDescs(labelNames)
+	for name, state := range states {
+		collectProbeState(ch, descs, name, state)
+	}
+}
+
+func collectProbeState(ch chan<- prometheus.Metric, descs probeMetricDescs, name string, state probeState) {
+	if state.LastCheck.IsZero() {
+		// Probe was not yet checked, there is nothing to report
+		return
+	}
+
+	if state.Certificate != nil {
+		ch <- prometheus.MustNewConstMetric(descs.expires, prometheus.GaugeValue,
+			float64(state.Certificate.NotAfter.UTC().Unix()),
+			descs.labelValues(state.Labels, name)...)
+	}
+	if state.LimitingCertificate != nil {
+		ch <- prometheus.MustNewConstMetric(descs.chainExpires, prometheus.GaugeValue,
+			float64(state.LimitingCertificate.NotAfter.UTC().Unix()),
+			descs.labelValues(state.Labels, name)...)
+	}
+	ch <- prometheus.MustNewConstMetric(descs.isValid, prometheus.GaugeValue,
+		state.Status.validity(),
+		descs.labelValues(state.Labels, name, state.Reason)...)
+
+	if state.OCSP != nil {
+		collectOCSPResult(ch, descs, name, state.Labels, state.OCSP)
+	}
+	if len(state.CRL) > 0 {
+		collectCRLResults(ch, descs, name, state.Labels, state.CRL)
+	}
+	if state.CT != nil {
+		collectCTResult(ch, descs, name, state.Labels, state.CT)
+	}
+
+	for addr, res := range state.Addresses {
+		if res.Certificate != nil {
+			ch <- prometheus.MustNewConstMetric(descs.addressExpires, prometheus.GaugeValue,
+				float64(res.Certificate.NotAfter.UTC().Unix()),
+				descs.labelValues(state.Labels, name, addr)...)
+		}
+		if res.LimitingCertificate != nil {
+			ch <- prometheus.MustNewConstMetric(descs.addressChainExpires, prometheus.GaugeValue,
+				float64(res.LimitingCertificate.NotAfter.UTC().Unix()),
+				descs.labelValues(state.Labels, name, addr)...)
+		}
+		ch <- prometheus.MustNewConstMetric(descs.addressIsValid, prometheus.GaugeValue,
+			res.Status.validity(),
+			descs.labelValues(state.Labels, name, addr, res.Reason)...)
+	}
+}
+
+func collectOCSPResult(ch chan<- prometheus.Metric, descs probeMetricDescs, name string, labels map[string]string, res *ocspResult) {
+	for _, status := range ocspStatuses {
+		var value float64
+		if res.Status == status {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(descs.ocspStatus, prometheus.GaugeValue,
+			value, descs.labelValues(labels, name, status)...)
+	}
+
+	if res.Stapled != nil {
+		var stapled float64
+		if *res.Stapled {
+			stapled = 1
+		}
+		ch <- prometheus.MustNewConstMetric(descs.ocspStapled, prometheus.GaugeValue,
+			stapled, descs.labelValues(labels, name)...)
+	}
+
+	if !res.ThisUpdate.IsZero() {
+		ch <- prometheus.MustNewConstMetric(descs.ocspThisUpdate, prometheus.GaugeValue,
+			float64(res.ThisUpdate.UTC().Unix()), descs.labelValues(labels, name)...)
+	}
+	if !res.NextUpdate.IsZero() {
+		ch <- prometheus.MustNewConstMetric(descs.ocspNextUpdate, prometheus.GaugeValue,
+			float64(res.NextUpdate.UTC().Unix()), descs.labelValues(labels, name)...)
+	}
+}
+
+func collectCRLResults(ch chan<- prometheus.Metric, descs probeMetricDescs, name string, labels map[string]string, results []*crlResult) {
+	worst := worstCRLStatus(results)
+	for _, status := range crlStatuses {
+		var value float64
+		if worst == status {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(descs.crlStatus, prometheus.GaugeValue,
+			value, descs.labelValues(labels, name, status)...)
+	}
+
+	if nextUpdate := earliestCRLUpdate(results); !nextUpdate.IsZero() {
+		ch <- prometheus.MustNewConstMetric(descs.crlNextUpdate, prometheus.GaugeValue,
+			float64(nextUpdate.UTC().Unix()), descs.labelValues(labels, name)...)
+	}
+}
+
+func collectCTResult(ch chan<- prometheus.Metric, descs probeMetricDescs, name string, labels map[string]string, res *ctResult) {
+	var compliant float64
+	if res.Compliant {
+		compliant = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(descs.ctCompliant, prometheus.GaugeValue,
+		compliant, descs.labelValues(labels, name)...)
+	ch <- prometheus.MustNewConstMetric(descs.ctValidSCTs, prometheus.GaugeValue,
+		float64(res.ValidSCTs), descs.labelValues(labels, name)...)
+	ch <- prometheus.MustNewConstMetric(descs.ctOperators, prometheus.GaugeValue,
+		float64(res.Operators), descs.labelValues(labels, name)...)
+}
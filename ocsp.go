@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	ocspStatusGood    = "good"
+	ocspStatusRevoked = "revoked"
+	ocspStatusUnknown = "unknown"
+	ocspStatusError   = "error"
+
+	// ocspMaxResponseSize limits the response read from a responder
+	ocspMaxResponseSize = 1 << 20
+)
+
+// ocspStatuses are all values of the OCSP status in the order exported
+// as metric labels
+var ocspStatuses = []string{ocspStatusGood, ocspStatusRevoked, ocspStatusUnknown, ocspStatusError}
+
+// ocspResult holds the revocation status of a certificate according to
+// the stapled OCSP response or the one fetched from the responder
+type ocspResult struct {
+	// Status is one of good, revoked, unknown or error (no response
+	// could be obtained)
+	Status string
+	// Stapled tells whether the server stapled an OCSP response, it is
+	// not set for protocols without a TLS connection
+	Stapled *bool `json:",omitempty"`
+	// Responder is the URL of the responder queried if no usable
+	// stapled response was available
+	Responder  string `json:",omitempty"`
+	ThisUpdate time.Time
+	NextUpdate time.Time
+	RevokedAt  time.Time
+	Error      string `json:",omitempty"`
+
+	// sctList is the SCT list extension of the response if present
+	sctList []byte
+}
+
+// checkOCSP determines the revocation status of the certificate: A
+// valid stapled response is used if available, otherwise the responder
+// is queried. Offline protocols pass a nil staple.
+func checkOCSP(ctx context.Context, cert, issuer *x509.Certificate, staple []byte, stapling bool, opts verificationOptions) *ocspResult {
+	logger := log.WithFields(log.Fields{"subject": cert.Subject.CommonName, "serial": cert.SerialNumber})
+	result := &ocspResult{}
+
+	if stapling {
+		stapled := len(staple) > 0
+		result.Stapled = &stapled
+	}
+
+	if len(staple) > 0 {
+		resp, err := parseOCSPResponse(staple, cert, issuer)
+		if err == nil {
+			return result.withResponse(resp)
+		}
+		logger.WithError(err).Warn("Stapled OCSP response is not usable, querying responder")
+	}
+
+	result.Responder = opts.OCSPResponder
+	if result.Responder == "" && len(cert.OCSPServer) > 0 {
+		result.Responder = cert.OCSPServer[0]
+	}
+
+	if result.Responder == "" {
+		// Certificate does not support OCSP, there is nothing to check
+		return nil
+	}
+
+	resp, err := queryOCSPResponder(ctx, result.Responder, cert, issuer)
+	if err != nil {
+		logger.WithField("responder", result.Responder).WithError(err).Warn("Unable to query OCSP responder")
+		result.Status = ocspStatusError
+		result.Error = err.Error()
+		return result
+	}
+
+	return result.withResponse(resp)
+}
+
+func (o *ocspResult) withResponse(resp *ocsp.Response) *ocspResult {
+	switch resp.Status {
+	case ocsp.Good:
+		o.Status = ocspStatusGood
+	case ocsp.Revoked:
+		o.Status = ocspStatusRevoked
+		o.RevokedAt = resp.RevokedAt
+	default:
+		o.Status = ocspStatusUnknown
+	}
+
+	o.ThisUpdate = resp.ThisUpdate
+	o.NextUpdate = resp.NextUpdate
+
+	for _, ext := range resp.Extensions {
+		if ext.Id.Equal(oidOCSPSCTList) {
+			o.sctList = ext.Value
+		}
+	}
+
+	return o
+}
+
+// parseOCSPResponse parses and verifies the response for the
+// certificate and ensures it is not outdated
+func parseOCSPResponse(data []byte, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	// Without issuer only the signature of the embedded responder
+	// certificate is checked, its relation to the issuer is verified below
+	resp, err := ocsp.ParseResponseForCert(data, cert, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = verifyOCSPSigner(resp, issuer); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if resp.ThisUpdate.After(now) {
+		return nil, errors.New("OCSP response is not yet valid")
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(now) {
+		return nil, fmt.Errorf("OCSP response is outdated since %s", resp.NextUpdate)
+	}
+
+	return resp, nil
+}
+
+// verifyOCSPSigner ensures the response is signed by the issuer of the
+// certificate or by a responder certificate the issuer delegated the
+// signing of OCSP responses to (RFC 6960, section 4.2.2.2)
+func verifyOCSPSigner(resp *ocsp.Response, issuer *x509.Certificate) error {
+	switch {
+	case resp.Certificate == nil:
+		if err := resp.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("Bad OCSP signature: %s", err)
+		}
+		return nil
+
+	case resp.Certificate.Equal(issuer):
+		// Signature was already verified using the embedded certificate
+		return nil
+	}
+
+	if err := resp.Certificate.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("OCSP responder certificate is not issued by the issuer: %s", err)
+	}
+
+	for _, usage := range resp.Certificate.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return nil
+		}
+	}
+
+	return errors.New("OCSP responder certificate is not allowed to sign OCSP responses")
+}
+
+// queryOCSPResponder requests the status of the certificate from the
+// responder using a POST request
+func queryOCSPResponder(ctx context.Context, responder string, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	reqBody, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create OCSP request: %s", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, responder, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create OCSP request: %s", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP responder returned status %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, ocspMaxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read OCSP response: %s", err)
+	}
+
+	return parseOCSPResponse(data, cert, issuer)
+}
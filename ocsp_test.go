@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspResponse creates a response for the certificate signed by the
+// signer, the certificate of the signer is embedded unless it is the
+// issuer
+func ocspResponse(t *testing.T, issuer, signer testCA, cert *x509.Certificate, status int, nextUpdate time.Time) []byte {
+	t.Helper()
+
+	tmpl := ocsp.Response{
+		Status:       status,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   nextUpdate,
+	}
+	if status == ocsp.Revoked {
+		tmpl.RevokedAt = time.Now().Add(-time.Hour).Truncate(time.Second)
+		tmpl.RevocationReason = ocsp.KeyCompromise
+	}
+	if !signer.cert.Equal(issuer.cert) {
+		tmpl.Certificate = signer.cert
+	}
+
+	resp, err := ocsp.CreateResponse(issuer.cert, signer.cert, tmpl, signer.key)
+	if err != nil {
+		t.Fatalf("Unable to create OCSP response: %s", err)
+	}
+
+	return resp
+}
+
+// newTestOCSPResponder starts a stand-in OCSP responder answering every
+// request with the given response and counting the requests
+func newTestOCSPResponder(t *testing.T, response []byte, requests *int) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/ocsp-request" {
+			t.Errorf("Unexpected OCSP request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if _, err := ocsp.ParseRequest(body); err != nil {
+			t.Errorf("Unable to parse OCSP request: %s", err)
+		}
+
+		if response == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(response)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestCheckOCSPResponder(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	leaf := ca.issue(t, 10, &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}).cert
+	nextUpdate := time.Now().Add(time.Hour)
+
+	for _, tc := range []struct {
+		name     string
+		response []byte
+		status   string
+	}{
+		{name: "good", response: ocspResponse(t, ca, ca, leaf, ocsp.Good, nextUpdate), status: ocspStatusGood},
+		{name: "revoked", response: ocspResponse(t, ca, ca, leaf, ocsp.Revoked, nextUpdate), status: ocspStatusRevoked},
+		{name: "unknown", response: ocspResponse(t, ca, ca, leaf, ocsp.Unknown, nextUpdate), status: ocspStatusUnknown},
+		{name: "outdated", response: ocspResponse(t, ca, ca, leaf, ocsp.Good, time.Now().Add(-time.Minute)), status: ocspStatusError},
+		{name: "server error", response: nil, status: ocspStatusError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests int
+			srv := newTestOCSPResponder(t, tc.response, &requests)
+
+			res := checkOCSP(context.Background(), leaf, ca.cert, nil, true, verificationOptions{OCSP: true, OCSPResponder: srv.URL})
+
+			if res.Status != tc.status {
+				t.Errorf("Expected status %q, got %q (%s)", tc.status, res.Status, res.Error)
+			}
+			if requests != 1 {
+				t.Errorf("Expected one request to the responder, got %d", requests)
+			}
+			if res.Responder != srv.URL {
+				t.Errorf("Expected responder %q, got %q", srv.URL, res.Responder)
+			}
+			if res.Stapled == nil || *res.Stapled {
+				t.Errorf("Expected response not to be reported as stapled")
+			}
+			if tc.status == ocspStatusRevoked && res.RevokedAt.IsZero() {
+				t.Errorf("Expected revocation time to be set")
+			}
+		})
+	}
+}
+
+func TestCheckOCSPStaple(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	leaf := ca.issue(t, 10, &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}).cert
+
+	t.Run("valid staple", func(t *testing.T) {
+		var requests int
+		srv := newTestOCSPResponder(t, nil, &requests)
+		staple := ocspResponse(t, ca, ca, leaf, ocsp.Revoked, time.Now().Add(time.Hour))
+
+		res := checkOCSP(context.Background(), leaf, ca.cert, staple, true, verificationOptions{OCSP: true, OCSPResponder: srv.URL})
+
+		if res.Status != ocspStatusRevoked {
+			t.Errorf("Expected status %q, got %q (%s)", ocspStatusRevoked, res.Status, res.Error)
+		}
+		if res.Stapled == nil || !*res.Stapled {
+			t.Errorf("Expected response to be reported as stapled")
+		}
+		if requests != 0 {
+			t.Errorf("Expected responder not to be queried, got %d requests", requests)
+		}
+	})
+
+	t.Run("broken staple", func(t *testing.T) {
+		var requests int
+		srv := newTestOCSPResponder(t, ocspResponse(t, ca, ca, leaf, ocsp.Good, time.Now().Add(time.Hour)), &requests)
+
+		res := checkOCSP(context.Background(), leaf, ca.cert, []byte("garbage"), true, verificationOptions{OCSP: true, OCSPResponder: srv.URL})
+
+		if res.Status != ocspStatusGood {
+			t.Errorf("Expected status %q, got %q (%s)", ocspStatusGood, res.Status, res.Error)
+		}
+		if requests != 1 {
+			t.Errorf("Expected responder to be queried once, got %d requests", requests)
+		}
+	})
+
+	t.Run("offline without responder", func(t *testing.T) {
+		if res := checkOCSP(context.Background(), leaf, ca.cert, nil, false, verificationOptions{OCSP: true}); res != nil {
+			t.Errorf("Expected certificate without responder not to be checked, got %+v", res)
+		}
+	})
+}
+
+func TestVerifyOCSPSigner(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	other := newTestCA(t, "Other CA")
+	leaf := ca.issue(t, 10, &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}).cert
+
+	delegated := ca.issue(t, 20, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "OCSP responder"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	})
+	notDelegated := ca.issue(t, 21, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "Server"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	foreign := other.issue(t, 22, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "Foreign OCSP responder"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	})
+
+	nextUpdate := time.Now().Add(time.Hour)
+
+	for _, tc := range []struct {
+		name    string
+		signer  testCA
+		wantErr string
+	}{
+		{name: "issuer", signer: ca},
+		{name: "delegated responder", signer: delegated},
+		{name: "responder without OCSP signing usage", signer: notDelegated, wantErr: "not allowed to sign"},
+		{name: "responder of other issuer", signer: foreign, wantErr: "not issued by the issuer"},
+		{name: "other issuer", signer: other, wantErr: "not issued by the issuer"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseOCSPResponse(ocspResponse(t, ca, tc.signer, leaf, ocsp.Good, nextUpdate), leaf, ca.cert)
+
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("Expected response to be accepted, got %s", err)
+			case tc.wantErr != "" && err == nil:
+				t.Errorf("Expected response to be rejected")
+			case tc.wantErr != "" && !strings.Contains(err.Error(), tc.wantErr):
+				t.Errorf("Expected error containing %q, got %q", tc.wantErr, err)
+			}
+		})
+	}
+}
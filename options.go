@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Luzifer/go_helpers/v2/str"
+)
+
+// probeOptions contains settings for a single probe. They are specified
+// either in the config file or as query string within the fragment of
+// the probe URL, which is never sent to the server:
+// https://www.example.com/#connect=10.0.0.5:443
+type probeOptions struct {
+	// Connect is the host:port to connect to instead of the host in the
+	// probe URL. The host in the probe URL is still used as SNI / Host
+	// name and for certificate verification.
+	Connect string `yaml:"connect"`
+	// CRL overrides the global setting whether to check the revocation
+	// status using CRLs
+	CRL *bool `yaml:"crl"`
+	// CT overrides the global setting whether to verify the Signed
+	// Certificate Timestamps against the CT log list and policy
+	CT *bool `yaml:"ct"`
+	// ExpireCritical overrides the global critical expiry threshold for
+	// this probe
+	ExpireCritical time.Duration `yaml:"expire_critical"`
+	// ExpireWarning overrides the global expiry warning for this probe
+	ExpireWarning time.Duration `yaml:"expire_warning"`
+	// Interval overrides the global check interval for this probe
+	Interval time.Duration `yaml:"interval"`
+	// Labels are attached to the results and metrics of the probe
+	Labels map[string]string `yaml:"labels"`
+	// Name overrides the name the probe is identified by in the results
+	Name string `yaml:"name"`
+	// OCSP overrides the global setting whether to check the revocation
+	// status using OCSP
+	OCSP *bool `yaml:"ocsp"`
+	// OCSPResponder is the URL of the OCSP responder to query instead
+	// of the one named in the certificate
+	OCSPResponder string `yaml:"ocsp_responder"`
+	// ResolveAll overrides the global setting whether to check all
+	// addresses the probe host resolves to
+	ResolveAll *bool `yaml:"resolve_all"`
+	// ServerName is the name to use as SNI / Host name and for
+	// certificate verification while connecting to the host in the
+	// probe URL
+	ServerName string `yaml:"server_name"`
+	// Timeouts overrides the global timeouts for this probe, unset
+	// values fall back to the global timeouts
+	Timeouts probeTimeouts `yaml:"timeouts"`
+}
+
+// probeTimeouts contains the timeouts applied when checking a probe
+type probeTimeouts struct {
+	// Connect limits establishing the TCP connection
+	Connect time.Duration `yaml:"connect"`
+	// Handshake limits the TLS handshake
+	Handshake time.Duration `yaml:"handshake"`
+	// Probe limits the whole check of the probe including the protocol
+	// specific exchange, with resolve_all for all addresses together
+	Probe time.Duration `yaml:"probe"`
+}
+
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// merge returns a copy of the options with all values set in the
+// other options taking precedence
+func (o probeOptions) merge(other probeOptions) probeOptions {
+	if other.Connect != "" {
+		o.Connect = other.Connect
+	}
+	if other.CRL != nil {
+		o.CRL = other.CRL
+	}
+	if other.CT != nil {
+		o.CT = other.CT
+	}
+	if other.ExpireCritical != 0 {
+		o.ExpireCritical = other.ExpireCritical
+	}
+	if other.ExpireWarning != 0 {
+		o.ExpireWarning = other.ExpireWarning
+	}
+	if other.Interval != 0 {
+		o.Interval = other.Interval
+	}
+	if len(other.Labels) > 0 {
+		labels := map[string]string{}
+		for k, v := range o.Labels {
+			labels[k] = v
+		}
+		for k, v := range other.Labels {
+			labels[k] = v
+		}
+		o.Labels = labels
+	}
+	if other.Name != "" {
+		o.Name = other.Name
+	}
+	if other.OCSP != nil {
+		o.OCSP = other.OCSP
+	}
+	if other.OCSPResponder != "" {
+		o.OCSPResponder = other.OCSPResponder
+	}
+	if other.ResolveAll != nil {
+		o.ResolveAll = other.ResolveAll
+	}
+	if other.ServerName != "" {
+		o.ServerName = other.ServerName
+	}
+	if other.Timeouts.Connect != 0 {
+		o.Timeouts.Connect = other.Timeouts.Connect
+	}
+	if other.Timeouts.Handshake != 0 {
+		o.Timeouts.Handshake = other.Timeouts.Handshake
+	}
+	if other.Timeouts.Probe != 0 {
+		o.Timeouts.Probe = other.Timeouts.Probe
+	}
+
+	return o
+}
+
+// expiryThresholds returns the thresholds of the options falling back
+// to the global ones for those not set. A global threshold conflicting
+// with the one set for the probe is clamped to it so a single threshold
+// can be moved on its own.
+func (o probeOptions) expiryThresholds() expiryThresholds {
+	t := expiryThresholds{
+		Critical: cfg.ExpireCritical,
+		Warning:  cfg.ExpireWarning,
+	}
+
+	if o.ExpireCritical > 0 {
+		t.Critical = o.ExpireCritical
+		if o.ExpireWarning == 0 && t.Warning < t.Critical {
+			t.Warning = t.Critical
+		}
+	}
+	if o.ExpireWarning > 0 {
+		t.Warning = o.ExpireWarning
+		if o.ExpireCritical == 0 && t.Critical > t.Warning {
+			t.Critical = t.Warning
+		}
+	}
+
+	return t
+}
+
+// validate checks the options for values not possible to be checked
+// while parsing them (for example those from the config file)
+func (o probeOptions) validate() error {
+	if o.Connect != "" {
+		if _, _, err := net.SplitHostPort(o.Connect); err != nil {
+			return fmt.Errorf("Invalid connect address %q: %s", o.Connect, err)
+		}
+	}
+
+	for key, value := range map[string]time.Duration{
+		"expire_critical":    o.ExpireCritical,
+		"expire_warning":     o.ExpireWarning,
+		"interval":           o.Interval,
+		"timeouts.connect":   o.Timeouts.Connect,
+		"timeouts.handshake": o.Timeouts.Handshake,
+		"timeouts.probe":     o.Timeouts.Probe,
+	} {
+		if value < 0 {
+			return fmt.Errorf("Invalid %s %q: must be positive", key, value)
+		}
+	}
+
+	if t := o.expiryThresholds(); t.Critical > t.Warning {
+		return fmt.Errorf("Invalid expire_critical %q: must not exceed expire_warning %q", t.Critical, t.Warning)
+	}
+
+	if o.CT != nil && *o.CT && ctLogs == nil {
+		return errors.New("Invalid ct: verifying SCTs requires a CT log list (--ct-log-list)")
+	}
+
+	if o.OCSPResponder != "" {
+		if u, err := url.Parse(o.OCSPResponder); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("Invalid OCSP responder %q: must be a HTTP(S) URL", o.OCSPResponder)
+		}
+	}
+
+	for name := range o.Labels {
+		if !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("Invalid label name %q", name)
+		}
+		if str.StringInSlice(name, reservedLabelNames) {
+			return fmt.Errorf("Label name %q is reserved", name)
+		}
+	}
+
+	return nil
+}
+
+// parseProbeOptions parses the options given in the fragment of the
+// probe URL, they are validated after merging them with the options from
+// the config file
+func parseProbeOptions(probeURL *url.URL) (probeOptions, error) {
+	var opts probeOptions
+
+	values, err := url.ParseQuery(probeURL.Fragment)
+	if err != nil {
+		return opts, fmt.Errorf("Unable to parse probe options: %s", err)
+	}
+
+	for key := range values {
+		switch key {
+		case "connect":
+			opts.Connect = values.Get(key)
+
+		case "connect-timeout":
+			opts.Timeouts.Connect, err = parsePositiveDuration(key, values.Get(key))
+
+		case "crl":
+			var crlEnabled bool
+			if crlEnabled, err = strconv.ParseBool(values.Get(key)); err != nil {
+				err = fmt.Errorf("Invalid %s %q: %s", key, values.Get(key), err)
+			}
+			opts.CRL = &crlEnabled
+
+		case "ct":
+			var ctEnabled bool
+			if ctEnabled, err = strconv.ParseBool(values.Get(key)); err != nil {
+				err = fmt.Errorf("Invalid %s %q: %s", key, values.Get(key), err)
+			}
+			opts.CT = &ctEnabled
+
+		case "expire-critical":
+			opts.ExpireCritical, err = parsePositiveDuration(key, values.Get(key))
+
+		case "expire-warning":
+			opts.ExpireWarning, err = parsePositiveDuration(key, values.Get(key))
+
+		case "handshake-timeout":
+			opts.Timeouts.Handshake, err = parsePositiveDuration(key, values.Get(key))
+
+		case "interval":
+			opts.Interval, err = parsePositiveDuration(key, values.Get(key))
+
+		case "name":
+			opts.Name = values.Get(key)
+
+		case "ocsp":
+			var ocspEnabled bool
+			if ocspEnabled, err = strconv.ParseBool(values.Get(key)); err != nil {
+				err = fmt.Errorf("Invalid %s %q: %s", key, values.Get(key), err)
+			}
+			opts.OCSP = &ocspEnabled
+
+		case "ocsp-responder":
+			opts.OCSPResponder = values.Get(key)
+
+		case "probe-timeout":
+			opts.Timeouts.Probe, err = parsePositiveDuration(key, values.Get(key))
+
+		case "resolve-all":
+			var resolveAll bool
+			if resolveAll, err = strconv.ParseBool(values.Get(key)); err != nil {
+				err = fmt.Errorf("Invalid %s %q: %s", key, values.Get(key), err)
+			}
+			opts.ResolveAll = &resolveAll
+
+		case "server-name":
+			opts.ServerName = values.Get(key)
+
+		default:
+			return opts, fmt.Errorf("Unknown probe option %q", key)
+		}
+
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
+
+func parsePositiveDuration(key, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s %q: %s", key, value, err)
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("Invalid %s %q: must be positive", key, value)
+	}
+
+	return d, nil
+}
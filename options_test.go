@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// useTestExpiryThresholds sets the global thresholds for the duration
+// of the test
+func useTestExpiryThresholds(t *testing.T, critical, warning time.Duration) {
+	prevCritical, prevWarning := cfg.ExpireCritical, cfg.ExpireWarning
+	cfg.ExpireCritical, cfg.ExpireWarning = critical, warning
+	t.Cleanup(func() { cfg.ExpireCritical, cfg.ExpireWarning = prevCritical, prevWarning })
+}
+
+func TestExpiryThresholds(t *testing.T) {
+	useTestExpiryThresholds(t, 168*time.Hour, 744*time.Hour)
+
+	for _, tc := range []struct {
+		name     string
+		opts     probeOptions
+		expected expiryThresholds
+	}{
+		{name: "global thresholds", opts: probeOptions{}, expected: expiryThresholds{Critical: 168 * time.Hour, Warning: 744 * time.Hour}},
+		{name: "both overridden", opts: probeOptions{ExpireCritical: 24 * time.Hour, ExpireWarning: 72 * time.Hour}, expected: expiryThresholds{Critical: 24 * time.Hour, Warning: 72 * time.Hour}},
+		{name: "warning below global critical", opts: probeOptions{ExpireWarning: 72 * time.Hour}, expected: expiryThresholds{Critical: 72 * time.Hour, Warning: 72 * time.Hour}},
+		{name: "warning above global critical", opts: probeOptions{ExpireWarning: 336 * time.Hour}, expected: expiryThresholds{Critical: 168 * time.Hour, Warning: 336 * time.Hour}},
+		{name: "critical above global warning", opts: probeOptions{ExpireCritical: 800 * time.Hour}, expected: expiryThresholds{Critical: 800 * time.Hour, Warning: 800 * time.Hour}},
+		{name: "critical below global warning", opts: probeOptions{ExpireCritical: 240 * time.Hour}, expected: expiryThresholds{Critical: 240 * time.Hour, Warning: 744 * time.Hour}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.opts.validate(); err != nil {
+				t.Errorf("Expected options to be valid, got %s", err)
+			}
+			if got := tc.opts.expiryThresholds(); got != tc.expected {
+				t.Errorf("Expected thresholds %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidateConflictingExpiryThresholds(t *testing.T) {
+	useTestExpiryThresholds(t, 168*time.Hour, 744*time.Hour)
+
+	opts := probeOptions{ExpireCritical: 72 * time.Hour, ExpireWarning: 24 * time.Hour}
+	if err := opts.validate(); err == nil {
+		t.Errorf("Expected critical threshold exceeding the warning threshold to be rejected")
+	}
+}
+
+func TestProbeOptionsValidatedAfterMerge(t *testing.T) {
+	// Not valid without a CT log list but disabled by the config file
+	def := probeDefinition{
+		URL:          "https://example.com/#ct=true",
+		probeOptions: probeOptions{CT: new(bool)},
+	}
+
+	if _, err := probeFromDefinition(def); err != nil {
+		t.Errorf("Expected probe to be created, got %s", err)
+	}
+
+	def.probeOptions.CT = nil
+	if _, err := probeFromDefinition(def); err == nil {
+		t.Errorf("Expected probe enabling CT without log list to be rejected")
+	}
+}
@@ -1,97 +1,421 @@
 package main
 
 import (
+	"context"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
 
 type probe struct {
+	// definition is the probe definition the probe was created from and
+	// used to detect changes when reloading the probes
+	definition probeDefinition
+	name       string
+	options    probeOptions
+	url        *url.URL
+
+	state     probeState
+	stateLock sync.RWMutex
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// pendingReason is reported instead of a result for probes not checked
+// yet
+const pendingReason = "pending"
+
+// probeState holds the result of the last check of a probe. It is
+// replaced as a whole on every refresh and never modified afterwards so
+// copies of it can safely be handed out.
+type probeState struct {
+	checkResult
+
+	Addresses map[string]*checkResult `json:",omitempty"`
+	Labels    map[string]string       `json:",omitempty"`
+	LastCheck time.Time
+}
+
+// checkResult holds the result of the check against one address: the
+// overall result of the probe or the one of an address the probe host
+// resolved to
+type checkResult struct {
 	Status      probeResult
+	Reason      string
 	Certificate *x509.Certificate
+	// LimitingCertificate is the certificate of the verified chains
+	// expiring first and therefore limiting the validity of the chain
+	LimitingCertificate *x509.Certificate `json:",omitempty"`
+	// OCSP is the revocation status of the certificate if checked
+	OCSP *ocspResult `json:",omitempty"`
+	// CRL contains the revocation status of the certificates of the
+	// chain having CRL distribution points if checked
+	CRL []*crlResult `json:",omitempty"`
+	// CT is the result of verifying the SCTs of the certificate if
+	// checked
+	CT *ctResult `json:",omitempty"`
+}
 
-	isValid prometheus.Gauge
-	expires prometheus.Gauge
-	url     *url.URL
+func newCheckResult(status probeResult, cert, limitingCert *x509.Certificate) *checkResult {
+	return &checkResult{
+		Status:              status,
+		Reason:              status.Reason(),
+		Certificate:         cert,
+		LimitingCertificate: limitingCert,
+	}
 }
 
-func probeFromURL(u string) (*probe, error) {
-	probeURL, err := url.Parse(u)
+func probeFromDefinition(def probeDefinition) (*probe, error) {
+	if def.URL == "" {
+		return nil, errors.New("Probe URL is missing")
+	}
+
+	probeURL, err := url.Parse(def.probeURL())
 	if err != nil {
 		return nil, err
 	}
 
-	p := &probe{
-		url: probeURL,
-		expires: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: "certcheck_expires",
-			Help: "Expiration date in unix timestamp (UTC)",
-			ConstLabels: prometheus.Labels{
-				"host": probeURL.Host,
-			},
-		}),
-		isValid: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: "certcheck_valid",
-			Help: "Validity of the certificate (0/1)",
-			ConstLabels: prometheus.Labels{
-				"host": probeURL.Host,
-			},
-		}),
+	opts, err := parseProbeOptions(probeURL)
+	if err != nil {
+		return nil, err
+	}
+	// Options are not part of the URL to request
+	probeURL.Fragment = ""
+
+	opts = opts.merge(def.probeOptions)
+	if err = opts.validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.ServerName != "" {
+		// Keep connecting to the host given in the URL while presenting
+		// the server name instead
+		if opts.Connect == "" {
+			if opts.Connect, err = probeAddress(probeURL); err != nil {
+				return nil, err
+			}
+		}
+
+		if probeURL.Port() != "" {
+			probeURL.Host = net.JoinHostPort(opts.ServerName, probeURL.Port())
+		} else {
+			probeURL.Host = opts.ServerName
+		}
+	}
+
+	name, err := probeName(probeURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &probe{
+		definition: def,
+		name:       name,
+		options:    opts,
+		url:        probeURL,
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// probeName returns the name to identify the probe by: For HTTPS probes
+// this is the host as specified in the URL, for all other protocols the
+// port is always included as the same host is likely to be probed on
+// different ports for different protocols. When connecting to a custom
+// address that address is appended to distinguish the probe from one
+// against the same host using the regular address.
+func probeName(probeURL *url.URL, opts probeOptions) (string, error) {
+	if opts.Name != "" {
+		return opts.Name, nil
+	}
+
+	proto, err := protocolForURL(probeURL)
+	if err != nil {
+		return "", err
+	}
+
+	name := probeURL.Host
+	switch {
+	case proto.offline():
+		// There is no address but the path identifies the certificate
+		name = probeURL.Host + probeURL.Path
+		if probeURL.RawQuery != "" {
+			name += "?" + probeURL.RawQuery
+		}
+
+	case probeURL.Scheme != "https":
+		if name, err = probeAddress(probeURL); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.Connect != "" {
+		name = strings.Join([]string{name, opts.Connect}, "@")
 	}
 
-	prometheus.MustRegister(p.expires)
-	prometheus.MustRegister(p.isValid)
+	return name, nil
+}
 
-	return p, nil
+// connectAddress returns the address to connect to: either the one
+// specified in the probe options or the one derived from the probe URL
+func (p *probe) connectAddress() (string, error) {
+	if p.options.Connect != "" {
+		return p.options.Connect, nil
+	}
+	return probeAddress(p.url)
+}
+
+// expiryThresholds returns how long before the expiry of the
+// certificate the probe starts to warn about it and when it becomes
+// critical
+func (p *probe) expiryThresholds() expiryThresholds {
+	return p.options.expiryThresholds()
+}
+
+// interval returns the check interval of the probe
+func (p *probe) interval() time.Duration {
+	if p.options.Interval > 0 {
+		return p.options.Interval
+	}
+	return cfg.CheckInterval
+}
+
+// timeouts returns the timeouts to apply when checking the probe
+func (p *probe) timeouts() probeTimeouts {
+	t := probeTimeouts{
+		Connect:   cfg.ConnectTimeout,
+		Handshake: cfg.HandshakeTimeout,
+		Probe:     cfg.ProbeTimeout,
+	}
+
+	if p.options.Timeouts.Connect > 0 {
+		t.Connect = p.options.Timeouts.Connect
+	}
+	if p.options.Timeouts.Handshake > 0 {
+		t.Handshake = p.options.Timeouts.Handshake
+	}
+	if p.options.Timeouts.Probe > 0 {
+		t.Probe = p.options.Timeouts.Probe
+	}
+
+	return t
+}
+
+// verificationOptions returns which additional checks to execute for
+// the certificates of the probe
+func (p *probe) verificationOptions() verificationOptions {
+	r := verificationOptions{
+		CRL:           cfg.CRL,
+		CT:            cfg.CT,
+		OCSP:          cfg.OCSP,
+		OCSPResponder: p.options.OCSPResponder,
+	}
+
+	if p.options.CRL != nil {
+		r.CRL = *p.options.CRL
+	}
+	if p.options.CT != nil {
+		r.CT = *p.options.CT
+	}
+	if p.options.OCSP != nil {
+		r.OCSP = *p.options.OCSP
+	}
+
+	return r
+}
+
+// resolveAll returns whether to check all addresses the host resolves to
+func (p *probe) resolveAll() bool {
+	if proto, _ := protocolForURL(p.url); proto.offline() {
+		// There are no addresses to resolve
+		return false
+	}
+
+	if p.options.ResolveAll != nil {
+		return *p.options.ResolveAll
+	}
+	return cfg.ResolveAll
 }
 
 func (p *probe) refresh() error {
-	verificationResult, verifyCert := checkCertificate(p.url)
+	addr, err := p.connectAddress()
+	if err != nil {
+		return fmt.Errorf("Unable to determine probe address: %s", err)
+	}
+
+	var (
+		resolveAll   = p.resolveAll()
+		thresholds   = p.expiryThresholds()
+		timeouts     = p.timeouts()
+		verification = p.verificationOptions()
+	)
+
+	// The probe timeout limits the whole check, with multiple addresses
+	// those are checked in parallel within the same deadline
+	ctx, cancel := context.WithTimeout(context.Background(), timeouts.Probe)
+	defer cancel()
 
+	if !resolveAll && p.options.Connect == "" {
+		result := checkCertificate(ctx, p.url, addr, timeouts, thresholds, verification)
+		p.logResult(result).Debug("Probe finished")
+
+		if err := p.update(result, nil); err != nil {
+			return fmt.Errorf("Unable to update probe state: %s", err)
+		}
+
+		return nil
+	}
+
+	// Report results per address when resolving all addresses or when
+	// connecting to a custom address to make the address visible
+	addrs := []string{addr}
+	if resolveAll {
+		if addrs, err = resolveProbeAddresses(ctx, addr); err != nil {
+			log.WithFields(log.Fields{"host": p.name}).WithError(err).Error("Unable to resolve probe host")
+			if err := p.update(newCheckResult(generalFailure, nil, nil), nil); err != nil {
+				return fmt.Errorf("Unable to update probe state: %s", err)
+			}
+			return nil
+		}
+	}
+
+	var (
+		results     = map[string]*checkResult{}
+		resultsLock sync.Mutex
+		wg          sync.WaitGroup
+	)
+
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+
+			result := checkCertificate(ctx, p.url, addr, timeouts, thresholds, verification)
+			p.logResult(result).WithField("address", addr).Debug("Address probe finished")
+
+			resultsLock.Lock()
+			results[addr] = result
+			resultsLock.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+
+	result := aggregateAddressResults(results)
+	p.logResult(result).Debug("Probe finished")
+
+	if err := p.update(result, results); err != nil {
+		return fmt.Errorf("Unable to update probe state: %s", err)
+	}
+
+	return nil
+}
+
+// aggregateAddressResults determines the overall probe result from the
+// results of all addresses: The most severe result wins, on equal
+// severity the certificate expiring first is reported
+func aggregateAddressResults(results map[string]*checkResult) *checkResult {
+	var addrs []string
+	for addr := range results {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	var worst *checkResult
+	for _, addr := range addrs {
+		res := results[addr]
+
+		switch {
+		case worst == nil, res.Status.severity() > worst.Status.severity():
+			worst = res
+
+		case res.Status.severity() == worst.Status.severity() && res.Certificate != nil:
+			if worst.Certificate == nil || res.Certificate.NotAfter.Before(worst.Certificate.NotAfter) {
+				worst = res
+			}
+		}
+	}
+
+	if worst == nil {
+		// Host did resolve to no address at all
+		return newCheckResult(generalFailure, nil, nil)
+	}
+
+	return worst
+}
+
+func (p *probe) logResult(result *checkResult) *log.Entry {
 	probeLog := log.WithFields(log.Fields{
-		"host":   p.url.Host,
-		"result": verificationResult,
+		"host":   p.name,
+		"result": result.Status,
 	})
-	if verifyCert != nil {
+	if verifyCert := result.Certificate; verifyCert != nil {
 		probeLog = probeLog.WithFields(log.Fields{
 			"version":   verifyCert.Version,
 			"serial":    verifyCert.SerialNumber,
 			"subject":   verifyCert.Subject.CommonName,
 			"expires":   verifyCert.NotAfter,
 			"issuer":    verifyCert.Issuer.CommonName,
-			"alt_names": strings.Join(verifyCert.DNSNames, ", "),
+			"alt_names": strings.Join(certificateNames(verifyCert), ", "),
 		})
 	}
-	probeLog.Debug("Probe finished")
+	if limitingCert := result.LimitingCertificate; limitingCert != nil && limitingCert != result.Certificate {
+		probeLog = probeLog.WithFields(log.Fields{
+			"chain_expires":         limitingCert.NotAfter,
+			"chain_expires_subject": limitingCert.Subject.CommonName,
+		})
+	}
+	return probeLog
+}
 
-	if err := p.update(verificationResult, verifyCert); err != nil {
-		return fmt.Errorf("Unable to update probe state: %s", err)
+func (p *probe) update(result *checkResult, addresses map[string]*checkResult) error {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	p.state = probeState{
+		checkResult: *result,
+		Addresses:   addresses,
+		LastCheck:   time.Now(),
 	}
 
 	return nil
 }
 
-func (p *probe) update(status probeResult, cert *x509.Certificate) error {
-	p.Status = status
-	p.Certificate = cert
+// snapshot returns the result of the last check of the probe
+func (p *probe) snapshot() probeState {
+	p.stateLock.RLock()
+	defer p.stateLock.RUnlock()
 
-	p.updatePrometheus(status, cert)
+	state := p.state
+	// Labels are never modified after the probe was created
+	state.Labels = p.options.Labels
 
-	return nil
+	if state.LastCheck.IsZero() {
+		// The zero status would read as a valid certificate
+		state.Reason = pendingReason
+	}
+
+	return state
 }
 
-func (p probe) updatePrometheus(status probeResult, cert *x509.Certificate) {
-	if cert != nil {
-		p.expires.Set(float64(cert.NotAfter.UTC().Unix()))
-	}
+// stop signals the scheduler of the probe to stop refreshing it
+func (p *probe) stop() {
+	p.stopOnce.Do(func() { close(p.done) })
+}
 
-	if status == certificateExpiresSoon || status == certificateOK {
-		p.isValid.Set(1)
-	} else {
-		p.isValid.Set(0)
+// stopped returns whether the probe was stopped
+func (p *probe) stopped() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
 	}
 }
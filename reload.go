@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// configReloadDelay is the time to wait for further changes after
+	// the config file changed as editors tend to write files in multiple
+	// steps
+	configReloadDelay = time.Second
+	// kubernetesDataLink is the symlink swapped by Kubernetes when
+	// updating a ConfigMap volume
+	kubernetesDataLink = "..data"
+)
+
+var syncProbesLock sync.Mutex
+
+// loadConfig returns the configuration from the config file with the
+// probes given as CLI parameters added
+func loadConfig() (*configFile, error) {
+	config := &configFile{}
+
+	if cfg.Config != "" {
+		var err error
+		if config, err = loadConfigFile(cfg.Config); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, probeURL := range cfg.Probes {
+		config.Probes = append(config.Probes, probeDefinition{URL: probeURL})
+	}
+
+	for _, pattern := range cfg.FileSD {
+		config.FileSD = append(config.FileSD, fileSDConfig{Files: []string{pattern}})
+	}
+
+	return config, nil
+}
+
+// syncProbes brings the registered probes in line with the configured
+// ones: New probes are registered and scheduled, probes no longer
+// configured are removed and probes with changed definitions are
+// replaced. Unchanged probes keep their state and schedule.
+func syncProbes() error {
+	syncProbesLock.Lock()
+	defer syncProbesLock.Unlock()
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	setProbeModules(config.Modules)
+
+	var files []string
+	if cfg.Config != "" {
+		files = append(files, cfg.Config)
+	}
+	for _, sd := range config.FileSD {
+		files = append(files, sd.Files...)
+	}
+	watchFiles(files)
+
+	discovered, err := fileSDDefinitions(config.FileSD)
+	if err != nil {
+		return err
+	}
+	config.Probes = append(config.Probes, discovered...)
+
+	if err = updateDiscoveryRunners(config.discoverySources()); err != nil {
+		return err
+	}
+	config.Probes = append(config.Probes, discoveredDefinitions()...)
+
+	var (
+		configured = map[string]*probe{}
+		order      []string
+	)
+
+	for _, def := range config.Probes {
+		p, err := probeFromDefinition(def)
+		if err != nil {
+			log.WithError(err).Error("Unable to create probe")
+			continue
+		}
+
+		if _, ok := configured[p.name]; ok {
+			log.WithFields(log.Fields{"host": p.name}).Error("Probe is configured multiple times")
+			continue
+		}
+
+		configured[p.name] = p
+		order = append(order, p.name)
+	}
+
+	for _, p := range probeMonitors.Probes() {
+		if newProbe, ok := configured[p.name]; ok && reflect.DeepEqual(p.definition, newProbe.definition) {
+			// Keep the running probe
+			delete(configured, p.name)
+			continue
+		}
+
+		probeMonitors.Remove(p.name)
+		log.WithFields(log.Fields{"host": p.name}).Info("Probe removed")
+	}
+
+	for _, name := range order {
+		p, ok := configured[name]
+		if !ok {
+			continue
+		}
+
+		if err := probeMonitors.Add(p); err != nil {
+			return fmt.Errorf("Unable to register probe: %s", err)
+		}
+		scheduleProbe(p)
+
+		log.WithFields(log.Fields{
+			"host": p.name,
+		}).Info("Probe registered")
+	}
+
+	return nil
+}
+
+// reloadProbes synchronizes the probes and logs the outcome, errors
+// keep the probes registered before
+func reloadProbes(trigger string) {
+	logger := log.WithFields(log.Fields{"trigger": trigger})
+
+	if err := syncProbes(); err != nil {
+		logger.WithError(err).Error("Unable to reload probes, keeping current probes")
+		return
+	}
+
+	logger.Info("Probes reloaded")
+}
+
+// watchReloadSignal reloads the probes whenever a SIGHUP is received
+func watchReloadSignal() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	go func() {
+		for range sigs {
+			reloadProbes("signal")
+		}
+	}()
+}
+
+var (
+	watchedFiles     []string
+	watchedFilesLock sync.RWMutex
+	fileWatcher      *fsnotify.Watcher
+)
+
+// startFileWatcher reloads the probes whenever one of the files set by
+// watchFiles changes. The directories are watched instead of the files
+// themselves to also notice files being created or replaced (for
+// example Kubernetes ConfigMap volumes swapping a symlink).
+func startFileWatcher() error {
+	var err error
+	if fileWatcher, err = fsnotify.NewWatcher(); err != nil {
+		return fmt.Errorf("Unable to create file watcher: %s", err)
+	}
+
+	go func() {
+		var reload <-chan time.Time
+
+		for {
+			select {
+			case evt := <-fileWatcher.Events:
+				if !isWatchedFile(evt.Name) {
+					// Some other file in the same directory
+					continue
+				}
+
+				log.WithFields(log.Fields{"file": evt.Name, "op": evt.Op}).Debug("Watched file changed")
+				// Wait for the changes to settle before reloading
+				reload = time.After(configReloadDelay)
+
+			case err := <-fileWatcher.Errors:
+				log.WithError(err).Error("Unable to watch files")
+
+			case <-reload:
+				reload = nil
+				reloadProbes("file")
+			}
+		}
+	}()
+
+	return nil
+}
+
+// watchFiles sets the files (or glob patterns) to reload the probes on
+func watchFiles(patterns []string) {
+	watchedFilesLock.Lock()
+	defer watchedFilesLock.Unlock()
+
+	watchedFiles = nil
+	for _, pattern := range patterns {
+		pattern = filepath.Clean(pattern)
+		watchedFiles = append(watchedFiles, pattern)
+
+		if fileWatcher == nil {
+			continue
+		}
+
+		if err := fileWatcher.Add(filepath.Dir(pattern)); err != nil {
+			log.WithFields(log.Fields{"file": pattern}).WithError(err).Error("Unable to watch directory")
+		}
+	}
+}
+
+// isWatchedFile returns whether a change of the given file needs to
+// trigger a reload
+func isWatchedFile(filename string) bool {
+	watchedFilesLock.RLock()
+	defer watchedFilesLock.RUnlock()
+
+	filename = filepath.Clean(filename)
+	for _, pattern := range watchedFiles {
+		if filepath.Dir(pattern) != filepath.Dir(filename) {
+			continue
+		}
+
+		if match, _ := filepath.Match(pattern, filename); match || filepath.Base(filename) == kubernetesDataLink {
+			return true
+		}
+	}
+
+	return false
+}
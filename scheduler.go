@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// scheduleProbe starts the periodic refresh of the probe in its own
+// interval. The first refresh is delayed by a random duration within
+// the configured jitter so many probes don't fire at the same time.
+func scheduleProbe(p *probe) {
+	interval := p.interval()
+
+	var delay time.Duration
+	if jitter := minDuration(cfg.CheckJitter, interval); jitter > 0 {
+		delay = time.Duration(rand.Int63n(int64(jitter)))
+	}
+
+	log.WithFields(log.Fields{
+		"host":     p.name,
+		"interval": interval,
+		"delay":    delay,
+	}).Debug("Probe scheduled")
+
+	go func() {
+		select {
+		case <-time.After(delay):
+		case <-p.done:
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			probeQueue.enqueue(p)
+
+			select {
+			case <-ticker.C:
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+func refreshProbe(p *probe) {
+	logger := log.WithFields(log.Fields{
+		"host": p.name,
+	})
+
+	if err := p.refresh(); err != nil {
+		logger.WithError(err).Error("Unable to refresh probe status")
+		return
+	}
+
+	logger.Debug("Probe refreshed")
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
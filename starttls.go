@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"golang.org/x/crypto/cryptobyte"
+	casn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+const (
+	xmppStreamNamespace = "http://etherx.jabber.org/streams"
+	xmppTLSNamespace    = "urn:ietf:params:xml:ns:xmpp-tls"
+
+	// ldapStartTLSOID is the name of the StartTLS extended operation
+	// (RFC 4511, section 4.14)
+	ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+	// ldapMaxMessageSize limits the response read from the server
+	ldapMaxMessageSize = 1 << 16
+
+	// BER tags of the LDAP messages (RFC 4511, section 4.12): The
+	// operations are constructed elements of the application class
+	berTagSequence          = 0x30
+	berTagInteger           = 0x02
+	berTagEnumerated        = 0x0a
+	berTagOctetString       = 0x04
+	ldapExtendedRequestTag  = casn1.Tag(0x40 | 23)
+	ldapExtendedResponseTag = 0x40 | 0x20 | 24
+)
+
+func fetchSMTPConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error) {
+	conn, err := d.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	client, err := smtp.NewClient(conn, probeURL.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read SMTP greeting: %s", err)
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); !ok {
+		return nil, fmt.Errorf("Server does not announce STARTTLS")
+	}
+
+	// StartTLS executes the handshake internally
+	conn.SetDeadline(d.handshakeDeadline(ctx))
+	if err = client.StartTLS(probeTLSConfig(probeURL.Hostname())); err != nil {
+		if _, ok := err.(*textproto.Error); ok {
+			return nil, fmt.Errorf("Server rejected STARTTLS: %s", err)
+		}
+		return nil, handshakeError{err}
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	state, _ := client.TLSConnectionState()
+	client.Quit()
+
+	return &state, nil
+}
+
+func fetchIMAPConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error) {
+	return fetchTextprotoConnectionState(ctx, d, probeURL, addr, "* OK", "a001 STARTTLS", "a001 ", "a001 OK")
+}
+
+func fetchPOP3ConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error) {
+	return fetchTextprotoConnectionState(ctx, d, probeURL, addr, "+OK", "STLS", "", "+OK")
+}
+
+func fetchSieveConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error) {
+	return fetchTextprotoConnectionState(ctx, d, probeURL, addr, "OK", "STARTTLS", "", "OK")
+}
+
+func fetchXMPPClientConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error) {
+	return fetchXMPPConnectionState(ctx, d, probeURL, addr, "jabber:client")
+}
+
+func fetchXMPPServerConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error) {
+	return fetchXMPPConnectionState(ctx, d, probeURL, addr, "jabber:server")
+}
+
+// fetchXMPPConnectionState opens a stream to the domain of the probe URL
+// and negotiates TLS using the STARTTLS stream feature (RFC 6120,
+// section 5)
+func fetchXMPPConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr, namespace string) (*tls.ConnectionState, error) {
+	conn, err := d.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var domain bytes.Buffer
+	xml.EscapeText(&domain, []byte(probeURL.Hostname()))
+
+	if _, err = fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream to='%s' version='1.0' xmlns='%s' xmlns:stream='%s'>", domain.String(), namespace, xmppStreamNamespace); err != nil {
+		return nil, fmt.Errorf("Unable to open XMPP stream: %s", err)
+	}
+
+	// The server does not send anything after the proceed element until
+	// the handshake started, so the decoder can't read too much
+	decoder := xml.NewDecoder(conn)
+
+	if _, err = nextXMLElement(decoder, xmppStreamNamespace, "stream"); err != nil {
+		return nil, fmt.Errorf("Unable to read XMPP stream header: %s", err)
+	}
+
+	start, err := nextXMLElement(decoder, xmppStreamNamespace, "features")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read XMPP stream features: %s", err)
+	}
+
+	var features struct {
+		StartTLS *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	}
+	if err = decoder.DecodeElement(&features, &start); err != nil {
+		return nil, fmt.Errorf("Unable to read XMPP stream features: %s", err)
+	}
+
+	if features.StartTLS == nil {
+		return nil, errors.New("Server does not announce STARTTLS")
+	}
+
+	if _, err = fmt.Fprintf(conn, "<starttls xmlns='%s'/>", xmppTLSNamespace); err != nil {
+		return nil, fmt.Errorf("Unable to send STARTTLS command: %s", err)
+	}
+
+	response, err := nextXMLElement(decoder, xmppTLSNamespace, "")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read STARTTLS response: %s", err)
+	}
+
+	if response.Name.Local != "proceed" {
+		return nil, fmt.Errorf("Server rejected STARTTLS: %s", response.Name.Local)
+	}
+
+	return d.tlsClient(ctx, conn, probeURL.Hostname())
+}
+
+// nextXMLElement returns the next start element which needs to be in the
+// given namespace and have the given name if not empty
+func nextXMLElement(decoder *xml.Decoder, namespace, name string) (xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if start.Name.Space != namespace || (name != "" && start.Name.Local != name) {
+			return start, fmt.Errorf("Unexpected element %s %s", start.Name.Space, start.Name.Local)
+		}
+
+		return start, nil
+	}
+}
+
+// fetchLDAPConnectionState upgrades the connection using the StartTLS
+// extended operation (RFC 4511, section 4.14)
+func fetchLDAPConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr string) (*tls.ConnectionState, error) {
+	conn, err := d.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := cryptobyte.NewBuilder(nil)
+	req.AddASN1(casn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(1)
+		b.AddASN1(ldapExtendedRequestTag.Constructed(), func(b *cryptobyte.Builder) {
+			b.AddASN1(casn1.Tag(0).ContextSpecific(), func(b *cryptobyte.Builder) {
+				b.AddBytes([]byte(ldapStartTLSOID))
+			})
+		})
+	})
+
+	if _, err = conn.Write(req.BytesOrPanic()); err != nil {
+		return nil, fmt.Errorf("Unable to send StartTLS request: %s", err)
+	}
+
+	msg, err := readBERElement(conn, ldapMaxMessageSize)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read StartTLS response: %s", err)
+	}
+
+	if err = parseLDAPExtendedResponse(msg); err != nil {
+		return nil, err
+	}
+
+	return d.tlsClient(ctx, conn, probeURL.Hostname())
+}
+
+// parseLDAPExtendedResponse checks the result code of the extended
+// response. Servers (like Active Directory) use BER instead of DER so
+// the message is parsed manually.
+func parseLDAPExtendedResponse(msg []byte) error {
+	malformed := errors.New("Malformed StartTLS response")
+
+	tag, message, _, err := splitBERElement(msg)
+	if err != nil || tag != berTagSequence {
+		return malformed
+	}
+
+	// The message ID is not checked as the server may also respond with
+	// a notice of disconnection using message ID 0
+	tag, _, message, err = splitBERElement(message)
+	if err != nil || tag != berTagInteger {
+		return malformed
+	}
+
+	tag, response, _, err := splitBERElement(message)
+	if err != nil || tag != ldapExtendedResponseTag {
+		return malformed
+	}
+
+	tag, code, response, err := splitBERElement(response)
+	if err != nil || tag != berTagEnumerated || len(code) == 0 {
+		return malformed
+	}
+
+	var resultCode int
+	for _, b := range code {
+		resultCode = resultCode<<8 | int(b)
+	}
+
+	if resultCode == 0 {
+		return nil
+	}
+
+	// Skip the matched DN to report the diagnostic message
+	var diagnostic []byte
+	if tag, _, response, err = splitBERElement(response); err == nil && tag == berTagOctetString {
+		if tag, diagnostic, _, err = splitBERElement(response); err != nil || tag != berTagOctetString {
+			diagnostic = nil
+		}
+	}
+
+	return fmt.Errorf("Server rejected StartTLS: result code %d %s", resultCode, strings.TrimSpace(string(diagnostic)))
+}
+
+// readBERElement reads one BER encoded element with a definite length
+// of at most maxSize bytes from the reader
+func readBERElement(r io.Reader, maxSize int) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := int(header[1])
+	if header[1]&0x80 != 0 {
+		lengthBytes := make([]byte, header[1]&0x7f)
+		if len(lengthBytes) == 0 || len(lengthBytes) > 4 {
+			return nil, errors.New("Unsupported BER length")
+		}
+		if _, err := io.ReadFull(r, lengthBytes); err != nil {
+			return nil, err
+		}
+
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+		header = append(header, lengthBytes...)
+	}
+
+	if length < 0 || length > maxSize {
+		return nil, fmt.Errorf("Message exceeds %d bytes", maxSize)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+
+	return append(header, content...), nil
+}
+
+// splitBERElement splits the first BER encoded element with a single
+// byte tag and a definite length from the data
+func splitBERElement(data []byte) (tag byte, content, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, io.ErrUnexpectedEOF
+	}
+
+	tag, length, offset := data[0], int(data[1]), 2
+	if data[1]&0x80 != 0 {
+		n := int(data[1] & 0x7f)
+		if n == 0 || n > 4 || len(data) < 2+n {
+			return 0, nil, nil, errors.New("Unsupported BER length")
+		}
+
+		length = 0
+		for _, b := range data[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		offset += n
+	}
+
+	if length < 0 || len(data)-offset < length {
+		return 0, nil, nil, io.ErrUnexpectedEOF
+	}
+
+	return tag, data[offset : offset+length], data[offset+length:], nil
+}
+
+// fetchTextprotoConnectionState executes a line based STARTTLS upgrade:
+// Lines are read until one starts with the greeting prefix, then the
+// command is sent and lines are read until one starts with the
+// response prefix. That line needs to start with the success prefix
+// for the upgrade to be considered successful.
+func fetchTextprotoConnectionState(ctx context.Context, d dialer, probeURL *url.URL, addr, greeting, command, response, success string) (*tls.ConnectionState, error) {
+	conn, err := d.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+
+	if _, err = readLineWithPrefix(tp, greeting); err != nil {
+		return nil, fmt.Errorf("Unable to read greeting: %s", err)
+	}
+
+	if err = tp.PrintfLine("%s", command); err != nil {
+		return nil, fmt.Errorf("Unable to send STARTTLS command: %s", err)
+	}
+
+	line, err := readLineWithPrefix(tp, response)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read STARTTLS response: %s", err)
+	}
+
+	if !strings.HasPrefix(line, success) {
+		return nil, fmt.Errorf("Server rejected STARTTLS: %q", line)
+	}
+
+	return d.tlsClient(ctx, conn, probeURL.Hostname())
+}
+
+// readLineWithPrefix skips all lines not starting with the given prefix
+// (for example capabilities or untagged responses) and returns the first
+// line matching the prefix
+func readLineWithPrefix(tp *textproto.Conn, prefix string) (string, error) {
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return "", err
+		}
+
+		if strings.HasPrefix(line, prefix) {
+			return line, nil
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// probeStore holds the registered probes and synchronizes adding and
+// removing them with readers like the HTTP handlers
+type probeStore struct {
+	lock   sync.RWMutex
+	probes map[string]*probe
+}
+
+func newProbeStore() *probeStore {
+	return &probeStore{probes: map[string]*probe{}}
+}
+
+// Add registers the probe, names of probes need to be unique
+func (s *probeStore) Add(p *probe) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.probes[p.name]; ok {
+		return fmt.Errorf("Probe %q is already registered", p.name)
+	}
+
+	s.probes[p.name] = p
+	return nil
+}
+
+// Remove unregisters the probe with the given name and stops its
+// refreshes. The removed probe is returned or nil if no probe was
+// registered with that name.
+func (s *probeStore) Remove(name string) *probe {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p, ok := s.probes[name]
+	if !ok {
+		return nil
+	}
+
+	delete(s.probes, name)
+	p.stop()
+
+	return p
+}
+
+// Get returns the probe registered with the given name or nil
+func (s *probeStore) Get(name string) *probe {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.probes[name]
+}
+
+// Probes returns all registered probes ordered by name
+func (s *probeStore) Probes() []*probe {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	probes := make([]*probe, 0, len(s.probes))
+	for _, p := range s.probes {
+		probes = append(probes, p)
+	}
+
+	sort.Slice(probes, func(i, j int) bool { return probes[i].name < probes[j].name })
+
+	return probes
+}
+
+// Snapshot returns the results of the last checks of all registered
+// probes by their name
+func (s *probeStore) Snapshot() map[string]probeState {
+	snapshot := map[string]probeState{}
+	for _, p := range s.Probes() {
+		snapshot[p.name] = p.snapshot()
+	}
+	return snapshot
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	probeQueue = newRefreshQueue()
+
+	queueLength = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "certcheck_queue_length",
+		Help: "Number of probes waiting for a free worker",
+	})
+	probesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "certcheck_probes_in_flight",
+		Help: "Number of probes currently being checked",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(queueLength)
+	prometheus.MustRegister(probesInFlight)
+}
+
+// refreshQueue is a FIFO queue of probes waiting to be refreshed. A
+// probe is only queued once: If its next refresh is due while it is
+// still waiting it is not queued again.
+type refreshQueue struct {
+	cond   *sync.Cond
+	probes []*probe
+	queued map[*probe]bool
+}
+
+func newRefreshQueue() *refreshQueue {
+	return &refreshQueue{
+		cond:   sync.NewCond(new(sync.Mutex)),
+		queued: map[*probe]bool{},
+	}
+}
+
+func (r *refreshQueue) enqueue(p *probe) {
+	r.cond.L.Lock()
+	defer r.cond.L.Unlock()
+
+	if r.queued[p] {
+		log.WithFields(log.Fields{"host": p.name}).Warn("Probe is still queued, skipping refresh")
+		return
+	}
+
+	r.probes = append(r.probes, p)
+	r.queued[p] = true
+	queueLength.Set(float64(len(r.probes)))
+
+	r.cond.Signal()
+}
+
+func (r *refreshQueue) dequeue() *probe {
+	r.cond.L.Lock()
+	defer r.cond.L.Unlock()
+
+	for len(r.probes) == 0 {
+		r.cond.Wait()
+	}
+
+	p := r.probes[0]
+	r.probes = r.probes[1:]
+	delete(r.queued, p)
+	queueLength.Set(float64(len(r.probes)))
+
+	return p
+}
+
+// startRefreshWorkers starts the given number of workers refreshing the
+// probes from the queue
+func startRefreshWorkers(n int) {
+	for i := 0; i < n; i++ {
+		go func() {
+			for {
+				p := probeQueue.dequeue()
+				if p.stopped() {
+					// Probe was removed while waiting in the queue
+					continue
+				}
+
+				probesInFlight.Inc()
+				refreshProbe(p)
+				probesInFlight.Dec()
+			}
+		}()
+	}
+}